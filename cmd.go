@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const commandUsage = `Usage: aiproxy-free [flags] [command]
+
+Commands:
+  serve                                   start the http server (default)
+  migrate                                 migrate the database schema and exit
+  keys list [-namespace ns] [-key-prefix p] [-page n] [-page-size n]
+  keys show <key|sha256:key-hash>
+  keys delete <key|sha256:key-hash>
+  keys move <key|sha256:key-hash> <namespace>
+  usage show <namespace>
+  quota reset [-window day|month] [-reason r] [-actor a] <namespace>
+  export [-output file]                   write key mappings as JSON lines
+  import [-input file]                    read key mappings as JSON lines
+
+Keys are given in plain text, a key hash needs the sha256: prefix. Key hashes
+depend on KEY_HASH_SECRET, import only into a deployment with the same secret.
+keys move pins the key, revalidation keeps the namespace it was moved to.
+
+Flags:
+`
+
+func usage() {
+	fmt.Fprint(flag.CommandLine.Output(), commandUsage)
+	flag.PrintDefaults()
+}
+
+var errUsage = errors.New("invalid command, run with -h for usage")
+
+// runCommand 执行子命令，没有子命令时启动服务
+func runCommand(args []string) error {
+	if len(args) == 0 {
+		return serve()
+	}
+
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "serve":
+		return serve()
+	case "migrate":
+		initDatabase()
+		defer db.Close()
+
+		log.Info("database migrated")
+
+		return nil
+	case "keys":
+		return withDatabase(func() error { return keysCommand(args) })
+	case "usage":
+		return withDatabase(func() error { return usageCommand(args) })
+	case "quota":
+		return withDatabase(func() error { return quotaCommand(args) })
+	case "export":
+		return withDatabase(func() error { return exportCommand(args) })
+	case "import":
+		return withDatabase(func() error { return importCommand(args) })
+	default:
+		return errUsage
+	}
+}
+
+func withDatabase(run func() error) error {
+	initDatabase()
+	defer db.Close()
+
+	return run()
+}
+
+func printJSON(v any) error {
+	data, err := sonic.ConfigStd.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+
+	return err
+}
+
+// cliAudit 命令行的修改在审计记录中的操作人
+var cliAudit = db.Audit{Actor: "cli"}
+
+// keyHashArgPrefix 标记参数是key的哈希，没有前缀的参数一律作为明文key，
+// 否则恰好是64位十六进制的明文key会被当成哈希
+const keyHashArgPrefix = "sha256:"
+
+var keyHashPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// keyHashOf 参数可以是明文key或者带sha256:前缀的key哈希
+func keyHashOf(arg string) (string, error) {
+	hash, ok := strings.CutPrefix(arg, keyHashArgPrefix)
+	if !ok {
+		return db.HashKey(arg), nil
+	}
+
+	hash = strings.ToLower(hash)
+	if !keyHashPattern.MatchString(hash) {
+		return "", fmt.Errorf("invalid key hash %q, expected 64 hex characters", hash)
+	}
+
+	return hash, nil
+}
+
+func keysCommand(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("keys list", flag.ExitOnError)
+		namespace := fs.String("namespace", "", "only list keys of this namespace")
+		keyPrefix := fs.String("key-prefix", "", "only list keys starting with this prefix")
+		page := fs.Int("page", 1, "page number, starting from 1")
+		pageSize := fs.Int("page-size", 100, "keys per page")
+
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		mappings, total, err := db.ListMappings(
+			db.MappingFilter{Namespace: *namespace, KeyPrefix: *keyPrefix},
+			*pageSize,
+			(max(*page, 1)-1)*(*pageSize),
+		)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(map[string]any{"total": total, "mappings": mappings})
+	case "show":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		keyHash, err := keyHashOf(args[1])
+		if err != nil {
+			return err
+		}
+
+		mapping, err := db.GetMapping(keyHash)
+		if err != nil {
+			return err
+		}
+
+		return printJSON(mapping)
+	case "delete":
+		if len(args) != 2 {
+			return errUsage
+		}
+
+		keyHash, err := keyHashOf(args[1])
+		if err != nil {
+			return err
+		}
+
+		if err := db.DeleteMapping(cliAudit, keyHash); err != nil {
+			return err
+		}
+
+		log.Infof("deleted key mapping %s", keyHash)
+
+		return nil
+	case "move":
+		if len(args) != 3 {
+			return errUsage
+		}
+
+		keyHash, err := keyHashOf(args[1])
+		if err != nil {
+			return err
+		}
+
+		if err := db.UpdateMapping(cliAudit, keyHash, args[2], true); err != nil {
+			return err
+		}
+
+		log.Infof("moved key mapping %s to namespace %s", keyHash, args[2])
+
+		return nil
+	default:
+		return errUsage
+	}
+}
+
+func usageCommand(args []string) error {
+	if len(args) != 2 || args[0] != "show" {
+		return errUsage
+	}
+
+	namespace := args[1]
+
+	usedToday, nextReset, err := db.GetUsageInfo(namespace)
+	if err != nil {
+		return err
+	}
+
+	policy := db.EnforcedLimitPolicy()
+
+	usedThisMonth, nextMonthlyReset, err := db.GetMonthlyUsageInfo(
+		namespace,
+		policy.MonthlyLimitMode,
+	)
+	if err != nil {
+		return err
+	}
+
+	grants, err := db.ListCreditGrants(namespace, true)
+	if err != nil {
+		return err
+	}
+
+	keys, err := db.CountKeysByNamespace(namespace)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]any{
+		"namespace":               namespace,
+		"keys":                    keys,
+		"daily_limit":             policy.DailyRequestLimit,
+		"used_today":              usedToday,
+		"next_reset_time":         nextReset.Format(time.RFC3339),
+		"monthly_limit":           policy.MonthlyRequestLimit,
+		"used_this_month":         usedThisMonth,
+		"next_monthly_reset_time": nextMonthlyReset.Format(time.RFC3339),
+		"active_credit_grants":    grants,
+	})
+}
+
+func quotaCommand(args []string) error {
+	if len(args) == 0 || args[0] != "reset" {
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("quota reset", flag.ExitOnError)
+	window := fs.String("window", module.QuotaWindowDay, "window to reset, day or month")
+	reason := fs.String("reason", "", "reason written to the audit trail")
+	actor := fs.String("actor", "cli", "operator written to the audit trail")
+
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	if *window != module.QuotaWindowDay && *window != module.QuotaWindowMonth {
+		return fmt.Errorf("invalid window %q, must be day or month", *window)
+	}
+
+	adjustment := &module.QuotaAdjustment{
+		Namespace: fs.Arg(0),
+		Window:    *window,
+		Reason:    *reason,
+		CreatedBy: *actor,
+	}
+
+	if err := db.ResetQuota(db.Audit{Actor: *actor}, adjustment); err != nil {
+		return err
+	}
+
+	return printJSON(adjustment)
+}
+
+const exportPageSize = 1000
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	output := fs.String("output", "", "file to write, defaults to stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := sonic.ConfigStd.NewEncoder(bw)
+
+	var (
+		exported int
+		cursor   *db.MappingCursor
+	)
+
+	for {
+		mappings, err := db.ListMappingsAfter(cursor, exportPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, mapping := range mappings {
+			if err := enc.Encode(mapping); err != nil {
+				return err
+			}
+		}
+
+		exported += len(mappings)
+
+		if len(mappings) < exportPageSize {
+			break
+		}
+
+		last := mappings[len(mappings)-1]
+		cursor = &db.MappingCursor{CreatedAt: last.CreatedAt, KeyHash: last.KeyHash}
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	log.Infof("exported %d key mappings", exported)
+
+	return nil
+}
+
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	input := fs.String("input", "", "file to read, defaults to stdin")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var imported int
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var mapping module.KeyMapping
+		if err := sonic.Unmarshal(scanner.Bytes(), &mapping); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if !keyHashPattern.MatchString(mapping.KeyHash) || mapping.Namespace == "" {
+			return fmt.Errorf("line %d: key_hash and namespace are required", line)
+		}
+
+		if err := db.ImportMapping(cliAudit, &mapping); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		imported++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	log.Infof("imported %d key mappings", imported)
+
+	return nil
+}
@@ -1,5 +1,22 @@
 package config
 
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// MonthlyLimitModeCalendar resets the monthly limit on the first day of each month
+	MonthlyLimitModeCalendar = "calendar"
+	// MonthlyLimitModeRolling counts requests within the last 30 days
+	MonthlyLimitModeRolling = "rolling"
+
+	// MinUsageRetention is the shortest UsageRetention that still covers the
+	// monthly limit window
+	MinUsageRetention = 31 * 24 * time.Hour
+)
+
 var (
 	DebugEnabled      bool
 	DebugSQLEnabled   bool
@@ -7,8 +24,132 @@ var (
 	UpstreamBaseURL   string
 	UpstreamAPIKey    string
 	DailyRequestLimit int64
+	// MonthlyRequestLimit caps requests per namespace per month, 0 disables it
+	MonthlyRequestLimit int64
+	// MonthlyLimitMode is either MonthlyLimitModeCalendar or MonthlyLimitModeRolling
+	MonthlyLimitMode string
+	// ShadowLimitPolicy is evaluated alongside the enforced limits without ever
+	// rejecting requests, nil disables shadow mode
+	ShadowLimitPolicy *LimitPolicy
+	// MaxRequestBodySize caps the size of proxied request bodies in bytes, larger
+	// requests are rejected with 413 before they are read into memory
+	MaxRequestBodySize int64
+	// BillingUnitPrice is the USD price of one request reported by the OpenAI
+	// compatible billing endpoints, it only affects how the quota is displayed
+	BillingUnitPrice float64
+
+	// TrustedProxies are the CIDRs whose X-Forwarded-For / X-Real-IP headers are
+	// trusted when resolving the client IP, an empty list trusts no proxy
+	TrustedProxies []string
+	// IPDailyRequestLimit caps /v1 requests per client IP per day, 0 disables it
+	IPDailyRequestLimit int64
+	// IPBurstLimit caps requests per client IP within IPBurstWindow, 0 disables it
+	IPBurstLimit  int64
+	IPBurstWindow time.Duration
+	// IPv6PrefixLength aggregates IPv6 clients into one bucket per prefix
+	IPv6PrefixLength int64
+
+	// Global limits are shared by all namespaces to cap the upstream budget, 0 disables them
+	GlobalDailyRequestLimit   int64
+	GlobalMonthlyRequestLimit int64
+	GlobalDailyTokenLimit     int64
+	GlobalMonthlyTokenLimit   int64
+
+	RefundPolicy RefundPolicyConfig
+
+	// AuthCredentialSources are the places an api key is read from, in precedence order
+	AuthCredentialSources []string
+
+	// NamespaceResolvers are the resolvers tried in order for unknown keys
+	NamespaceResolvers []string
+	// StaticKeysFile is a JSON object of key to namespace used by the static resolver
+	StaticKeysFile string
+	// NamespaceWebhookURL is called by the webhook resolver
+	NamespaceWebhookURL     string
+	NamespaceWebhookTimeout time.Duration
+	// JWTSecret verifies HS256 tokens for the jwt resolver
+	JWTSecret string
+	// JWTJWKS is a local file or URL of the key set verifying RS256 / ES256 tokens
+	JWTJWKS         string
+	JWTJWKSCacheTTL time.Duration
+	// JWTOIDCDiscovery looks up the key set URL from the issuer's OpenID Connect
+	// discovery document when JWTJWKS is empty
+	JWTOIDCDiscovery bool
+	// JWTIssuer and JWTAudience are required in the iss and aud claims when set
+	JWTIssuer   string
+	JWTAudience string
+	// JWTLeeway tolerates clock skew when checking exp and nbf
+	JWTLeeway time.Duration
+	// JWTNamespaceClaim is the claim holding the namespace
+	JWTNamespaceClaim string
+
+	// KeyHashSecret is the HMAC secret api keys are hashed with before they are
+	// stored, changing it invalidates every stored key mapping
+	KeyHashSecret string
+
+	// LocalKeyPrefix marks keys issued by this proxy, such keys are never sent
+	// to the upstream for validation
+	LocalKeyPrefix string
+
+	// KeyCacheSize is how many key to namespace mappings each replica caches, 0 disables it
+	KeyCacheSize int64
+	KeyCacheTTL  time.Duration
+	// RejectedKeyCacheSize is how many keys rejected by the upstream each replica
+	// remembers for RejectedKeyCacheTTL, 0 disables it
+	RejectedKeyCacheSize int64
+	RejectedKeyCacheTTL  time.Duration
+	// KeyRevalidateInterval is how long a key mapping is trusted before it is
+	// revalidated against the upstream in the background, 0 disables it
+	KeyRevalidateInterval time.Duration
+	// KeyRevalidateHardExpiry is how long a key mapping is trusted before the
+	// request has to wait for its revalidation, 0 disables it
+	KeyRevalidateHardExpiry time.Duration
+
+	// AuditRetention is how long audit events are kept, 0 keeps them forever
+	AuditRetention time.Duration
+	// UsageRetention is how long request records are kept for usage history, 0
+	// keeps them forever. It is raised to MinUsageRetention while a monthly limit
+	// is set, shorter retention would delete requests the limit still counts
+	UsageRetention time.Duration
+
+	// WebhookEndpoints receive quota threshold, namespace and global budget events
+	WebhookEndpoints []WebhookEndpoint
+	// WebhookQuotaThresholds are the percentages of the daily limit that trigger
+	// a quota.threshold event, each at most once per namespace per day
+	WebhookQuotaThresholds []int64
+	// WebhookMaxAttempts is how many times a delivery is tried before it is given up
+	WebhookMaxAttempts int64
+	WebhookTimeout     time.Duration
+
+	// BanRefreshInterval is how often each replica reloads the ban list
+	BanRefreshInterval time.Duration
+	// PlanRefreshInterval is how often each replica reloads the saved plan
+	PlanRefreshInterval time.Duration
+
+	// AdminToken protects the /admin API, an empty token disables it
+	AdminToken string
+	// AdminSessionTTL is how long a dashboard login lasts
+	AdminSessionTTL time.Duration
 )
 
+var defaultTrustedProxies = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+}
+
+var defaultAuthCredentialSources = []string{
+	"authorization",
+	"x-api-key",
+	"api-key",
+	"x-goog-api-key",
+	"query",
+	"basic",
+}
+
 func ReloadEnv() {
 	DebugEnabled = Bool("DEBUG", false)
 	DebugSQLEnabled = Bool("DEBUG_SQL", false)
@@ -16,8 +157,88 @@ func ReloadEnv() {
 	UpstreamBaseURL = String("UPSTREAM_BASE_URL", "https://aiproxy.hzh.sealos.run")
 	UpstreamAPIKey = String("UPSTREAM_API_KEY", "")
 	DailyRequestLimit = Int64("DAILY_REQUEST_LIMIT", 30)
+	MonthlyRequestLimit = Int64("MONTHLY_REQUEST_LIMIT", 0)
+	MonthlyLimitMode = String("MONTHLY_LIMIT_MODE", MonthlyLimitModeCalendar)
+	ShadowLimitPolicy = JSON[*LimitPolicy]("SHADOW_LIMIT_POLICY", nil)
+	MaxRequestBodySize = Int64("MAX_REQUEST_BODY_SIZE", 32<<20)
+	BillingUnitPrice = Float64("BILLING_UNIT_PRICE", 0.01)
+
+	TrustedProxies = StringSlice("TRUSTED_PROXIES", defaultTrustedProxies)
+	IPDailyRequestLimit = Int64("IP_DAILY_REQUEST_LIMIT", 300)
+	IPBurstLimit = Int64("IP_BURST_LIMIT", 60)
+	IPBurstWindow = Duration("IP_BURST_WINDOW", time.Minute)
+	IPv6PrefixLength = Int64("IPV6_PREFIX_LENGTH", 64)
+
+	GlobalDailyRequestLimit = Int64("GLOBAL_DAILY_REQUEST_LIMIT", 0)
+	GlobalMonthlyRequestLimit = Int64("GLOBAL_MONTHLY_REQUEST_LIMIT", 0)
+	GlobalDailyTokenLimit = Int64("GLOBAL_DAILY_TOKEN_LIMIT", 0)
+	GlobalMonthlyTokenLimit = Int64("GLOBAL_MONTHLY_TOKEN_LIMIT", 0)
+
+	RefundPolicy = JSON("REFUND_POLICY", defaultRefundPolicy())
+
+	AuthCredentialSources = StringSlice("AUTH_CREDENTIAL_SOURCES", defaultAuthCredentialSources)
+
+	NamespaceResolvers = StringSlice("NAMESPACE_RESOLVERS", []string{"upstream"})
+	StaticKeysFile = String("STATIC_KEYS_FILE", "")
+	NamespaceWebhookURL = String("NAMESPACE_WEBHOOK_URL", "")
+	NamespaceWebhookTimeout = Duration("NAMESPACE_WEBHOOK_TIMEOUT", 10*time.Second)
+	JWTSecret = String("JWT_SECRET", "")
+	JWTJWKS = String("JWT_JWKS", "")
+	JWTJWKSCacheTTL = Duration("JWT_JWKS_CACHE_TTL", time.Hour)
+	JWTOIDCDiscovery = Bool("JWT_OIDC_DISCOVERY", false)
+	JWTIssuer = String("JWT_ISSUER", "")
+	JWTAudience = String("JWT_AUDIENCE", "")
+	JWTLeeway = Duration("JWT_LEEWAY", 30*time.Second)
+	JWTNamespaceClaim = String("JWT_NAMESPACE_CLAIM", "namespace")
+
+	KeyHashSecret = String("KEY_HASH_SECRET", "")
+
+	LocalKeyPrefix = String("LOCAL_KEY_PREFIX", "sk-free-")
+
+	KeyCacheSize = Int64("KEY_CACHE_SIZE", 10000)
+	KeyCacheTTL = Duration("KEY_CACHE_TTL", 10*time.Minute)
+	RejectedKeyCacheSize = Int64("REJECTED_KEY_CACHE_SIZE", 100000)
+	RejectedKeyCacheTTL = Duration("REJECTED_KEY_CACHE_TTL", 10*time.Minute)
+	KeyRevalidateInterval = Duration("KEY_REVALIDATE_INTERVAL", 24*time.Hour)
+	KeyRevalidateHardExpiry = Duration("KEY_REVALIDATE_HARD_EXPIRY", 7*24*time.Hour)
+
+	AuditRetention = Duration("AUDIT_RETENTION", 90*24*time.Hour)
+	UsageRetention = Duration("USAGE_RETENTION", 90*24*time.Hour)
+	clampUsageRetention()
+
+	WebhookEndpoints = validWebhookEndpoints(JSON[[]WebhookEndpoint]("WEBHOOK_ENDPOINTS", nil))
+	WebhookQuotaThresholds = JSON("WEBHOOK_QUOTA_THRESHOLDS", []int64{80, 100})
+	WebhookMaxAttempts = Int64("WEBHOOK_MAX_ATTEMPTS", 10)
+	WebhookTimeout = Duration("WEBHOOK_TIMEOUT", 10*time.Second)
+
+	BanRefreshInterval = Duration("BAN_REFRESH_INTERVAL", 30*time.Second)
+	PlanRefreshInterval = Duration("PLAN_REFRESH_INTERVAL", 30*time.Second)
+
+	AdminToken = String("ADMIN_TOKEN", "")
+	AdminSessionTTL = Duration("ADMIN_SESSION_TTL", 12*time.Hour)
 }
 
 func init() {
 	ReloadEnv()
 }
+
+// clampUsageRetention raises a UsageRetention shorter than the monthly limit
+// window when the enforced or shadow policy has a monthly limit
+func clampUsageRetention() {
+	if UsageRetention <= 0 || UsageRetention >= MinUsageRetention {
+		return
+	}
+
+	if MonthlyRequestLimit <= 0 &&
+		(ShadowLimitPolicy == nil || ShadowLimitPolicy.MonthlyRequestLimit <= 0) {
+		return
+	}
+
+	log.Warnf(
+		"USAGE_RETENTION %s is shorter than the monthly limit window, using %s",
+		UsageRetention,
+		MinUsageRetention,
+	)
+
+	UsageRetention = MinUsageRetention
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bytedance/sonic"
 	log "github.com/sirupsen/logrus"
@@ -96,3 +98,45 @@ func JSON[T any](env string, defaultValue T) T {
 
 	return t
 }
+
+func Duration(env string, defaultValue time.Duration) time.Duration {
+	if env == "" {
+		return defaultValue
+	}
+
+	e := os.Getenv(env)
+	if e == "" {
+		return defaultValue
+	}
+
+	d, err := time.ParseDuration(e)
+	if err != nil {
+		log.Errorf("invalid %s: %s", env, e)
+		return defaultValue
+	}
+
+	return d
+}
+
+func StringSlice(env string, defaultValue []string) []string {
+	if env == "" {
+		return defaultValue
+	}
+
+	e := os.Getenv(env)
+	if e == "" {
+		return defaultValue
+	}
+
+	parts := strings.Split(e, ",")
+
+	values := make([]string, 0, len(parts))
+	for _, p := range parts {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			values = append(values, p)
+		}
+	}
+
+	return values
+}
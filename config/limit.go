@@ -0,0 +1,21 @@
+package config
+
+// LimitPolicy is the set of per-namespace request limits
+type LimitPolicy struct {
+	// DailyRequestLimit caps requests per namespace per day
+	DailyRequestLimit int64 `json:"daily_request_limit"`
+	// MonthlyRequestLimit caps requests per namespace per month, 0 disables it
+	MonthlyRequestLimit int64 `json:"monthly_request_limit"`
+	// MonthlyLimitMode is either MonthlyLimitModeCalendar or MonthlyLimitModeRolling
+	MonthlyLimitMode string `json:"monthly_limit_mode"`
+}
+
+// EnforcedLimitPolicy returns the limit policy configured through the
+// environment, a plan saved through the admin API takes precedence over it
+func EnforcedLimitPolicy() LimitPolicy {
+	return LimitPolicy{
+		DailyRequestLimit:   DailyRequestLimit,
+		MonthlyRequestLimit: MonthlyRequestLimit,
+		MonthlyLimitMode:    MonthlyLimitMode,
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+// RefundPolicyConfig decides whether a request that was already counted against the
+// quota is given back after the upstream response is known
+type RefundPolicyConfig struct {
+	// RefundStatusClasses lists the response status classes that are refunded, e.g. "5xx"
+	RefundStatusClasses []string `json:"refund_status_classes"`
+	// RefundStatusCodes lists individual response status codes that are refunded
+	RefundStatusCodes []int `json:"refund_status_codes"`
+	// RefundErrorTypes lists upstream error types that are always refunded
+	RefundErrorTypes []string `json:"refund_error_types"`
+	// ChargeErrorTypes lists upstream error types that are never refunded
+	ChargeErrorTypes []string `json:"charge_error_types"`
+	// ChargeProducedTokens never refunds a request once the upstream produced any tokens
+	ChargeProducedTokens bool `json:"charge_produced_tokens"`
+	// RefundIncompleteStreams refunds successful responses that ended prematurely
+	RefundIncompleteStreams bool `json:"refund_incomplete_streams"`
+	// RefundClientCanceled refunds requests canceled by the client
+	RefundClientCanceled bool `json:"refund_client_canceled"`
+}
+
+func defaultRefundPolicy() RefundPolicyConfig {
+	return RefundPolicyConfig{
+		RefundStatusClasses:     []string{"5xx"},
+		RefundStatusCodes:       []int{429},
+		ChargeProducedTokens:    true,
+		RefundIncompleteStreams: true,
+		RefundClientCanceled:    true,
+	}
+}
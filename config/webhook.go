@@ -0,0 +1,57 @@
+package config
+
+import log "github.com/sirupsen/logrus"
+
+// WebhookEndpoint is an outbound webhook receiving events from this proxy
+type WebhookEndpoint struct {
+	URL string `json:"url"`
+	// Secret signs the payload with HMAC-SHA256, endpoints without one are rejected
+	Secret string `json:"secret"`
+	// Events lists the events sent to this endpoint, empty sends every event
+	Events []string `json:"events"`
+}
+
+// Subscribed reports whether the endpoint receives the event
+func (e WebhookEndpoint) Subscribed(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FindWebhookEndpoint returns the configured endpoint with the URL
+func FindWebhookEndpoint(url string) (WebhookEndpoint, bool) {
+	for _, endpoint := range WebhookEndpoints {
+		if endpoint.URL == url {
+			return endpoint, true
+		}
+	}
+
+	return WebhookEndpoint{}, false
+}
+
+// validWebhookEndpoints drops the endpoints without a URL or a secret, every
+// delivery is signed so receivers can always verify it
+func validWebhookEndpoints(endpoints []WebhookEndpoint) []WebhookEndpoint {
+	valid := make([]WebhookEndpoint, 0, len(endpoints))
+
+	for _, endpoint := range endpoints {
+		switch {
+		case endpoint.URL == "":
+			log.Error("invalid WEBHOOK_ENDPOINTS: endpoint without url is ignored")
+		case endpoint.Secret == "":
+			log.Errorf("invalid WEBHOOK_ENDPOINTS: endpoint %s without secret is ignored", endpoint.URL)
+		default:
+			valid = append(valid, endpoint)
+		}
+	}
+
+	return valid
+}
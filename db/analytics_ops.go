@@ -0,0 +1,193 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm/clause"
+)
+
+// NamespaceRequestCount 某个namespace在一段时间内的请求统计
+type NamespaceRequestCount struct {
+	Namespace string `json:"namespace"`
+	Requests  int64  `json:"requests"`
+	Refunded  int64  `json:"refunded"`
+	Rejected  int64  `json:"rejected"`
+}
+
+// UsageBucket 时间序列中的一个统计区间
+type UsageBucket struct {
+	Time     int64 `json:"time"` // 区间开始的毫秒时间戳
+	Requests int64 `json:"requests"`
+	Refunded int64 `json:"refunded"`
+	Rejected int64 `json:"rejected"`
+}
+
+// UsageSummary 一段时间内所有namespace的请求统计
+type UsageSummary struct {
+	Requests   int64 `json:"requests"`
+	Refunded   int64 `json:"refunded"`
+	Rejected   int64 `json:"rejected"`
+	Namespaces int64 `json:"namespaces"`
+}
+
+// ModelUsage 某个模型在一段时间内的请求统计
+type ModelUsage struct {
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+	Refunded int64  `json:"refunded"`
+	Rejected int64  `json:"rejected"`
+}
+
+// usageCountColumns 按状态分别计数，参数为usageCountArgs，只重置了每日额度的记录仍然是实际处理过的请求
+const usageCountColumns = "COUNT(*) FILTER (WHERE status IN ?) AS requests, " +
+	"COUNT(*) FILTER (WHERE status = ?) AS refunded, " +
+	"COUNT(*) FILTER (WHERE status = ?) AS rejected"
+
+var usageCountArgs = []any{
+	monthlyCountedStatuses,
+	module.RateLimitStatusRefunded,
+	module.RateLimitStatusRejected,
+}
+
+// groupByFirstColumn 按第一个查询列分组，gorm的Group("1")会把1当作列名加上引号
+var groupByFirstColumn = clause.GroupBy{Columns: []clause.Column{{Name: "1", Raw: true}}}
+
+// TopNamespaces 查询[from, to)内请求最多的namespace，orderByRejected为true时按被拒绝的请求排序
+func TopNamespaces(
+	from, to time.Time,
+	limit int,
+	orderByRejected bool,
+) ([]NamespaceRequestCount, error) {
+	order := "requests DESC"
+	if orderByRejected {
+		order = "rejected DESC"
+	}
+
+	var counts []NamespaceRequestCount
+
+	result := gdb.Model(&module.RateLimitRecord{}).
+		Select("namespace, "+usageCountColumns, usageCountArgs...).
+		Where("request_time >= ? AND request_time < ?", from.UnixMilli(), to.UnixMilli()).
+		Group("namespace").
+		Order(order + ", namespace ASC").
+		Limit(limit).
+		Scan(&counts)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to query top namespaces: %w", result.Error)
+	}
+
+	return counts, nil
+}
+
+// UsageSeries 按bucket长度统计[from, to)内的请求数，namespace为空时统计全部，
+// 区间按from所在时区的偏移对齐，只适用于不超过一小时的bucket，按天统计使用DailyUsageSeries。
+// 没有请求的区间不返回
+func UsageSeries(
+	namespace string,
+	from, to time.Time,
+	bucket time.Duration,
+) ([]UsageBucket, error) {
+	_, offset := from.Zone()
+	offsetMs := int64(offset) * 1000
+	bucketMs := bucket.Milliseconds()
+
+	// 先平移到本地时区再按区间取整，最后平移回UTC毫秒时间戳
+	bucketExpr := fmt.Sprintf(
+		"((request_time + %d) / %d) * %d - %d",
+		offsetMs, bucketMs, bucketMs, offsetMs,
+	)
+
+	return usageSeries(namespace, from, to, bucketExpr)
+}
+
+// DailyUsageSeries 按from所在时区的日历日统计[from, to)内的请求数，namespace为空时统计全部，
+// 区间的Time是当天零点。每天的边界在Go中按日期计算，夏令时切换的那天也是一个完整的日历日。
+// 没有请求的日期不返回
+func DailyUsageSeries(namespace string, from, to time.Time) ([]UsageBucket, error) {
+	loc := from.Location()
+
+	// days[i]是第i个日历日的零点，width_bucket返回request_time落在第几个区间，从1开始
+	var days []time.Time
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for day := start; day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+
+	if len(days) == 0 {
+		return nil, nil
+	}
+
+	bounds := make([]string, 0, len(days))
+	for _, day := range days {
+		bounds = append(bounds, strconv.FormatInt(day.UnixMilli(), 10))
+	}
+
+	bucketExpr := "width_bucket(request_time, ARRAY[" + strings.Join(bounds, ",") + "]::bigint[])"
+
+	buckets, err := usageSeries(namespace, from, to, bucketExpr)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, bucket := range buckets {
+		buckets[i].Time = days[bucket.Time-1].UnixMilli()
+	}
+
+	return buckets, nil
+}
+
+// usageSeries 按timeExpr分组统计[from, to)内的请求数，timeExpr的结果作为区间的Time
+func usageSeries(namespace string, from, to time.Time, timeExpr string) ([]UsageBucket, error) {
+	tx := gdb.Model(&module.RateLimitRecord{}).
+		Select(timeExpr+" AS time, "+usageCountColumns, usageCountArgs...).
+		Where("request_time >= ? AND request_time < ?", from.UnixMilli(), to.UnixMilli())
+	if namespace != "" {
+		tx = tx.Where("namespace = ?", namespace)
+	}
+
+	var buckets []UsageBucket
+
+	result := tx.Clauses(groupByFirstColumn).Order("1").Scan(&buckets)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to query usage series: %w", result.Error)
+	}
+
+	return buckets, nil
+}
+
+// GetUsageSummary 统计[from, to)内的请求总数、被拒绝的请求数和活跃namespace数
+func GetUsageSummary(from, to time.Time) (UsageSummary, error) {
+	var summary UsageSummary
+
+	result := gdb.Model(&module.RateLimitRecord{}).
+		Select(usageCountColumns+", COUNT(DISTINCT namespace) AS namespaces", usageCountArgs...).
+		Where("request_time >= ? AND request_time < ?", from.UnixMilli(), to.UnixMilli()).
+		Scan(&summary)
+	if result.Error != nil {
+		return UsageSummary{}, fmt.Errorf("failed to query usage summary: %w", result.Error)
+	}
+
+	return summary, nil
+}
+
+// UsageByModel 统计某个namespace在[from, to)内每个模型的请求数
+func UsageByModel(namespace string, from, to time.Time) ([]ModelUsage, error) {
+	var usages []ModelUsage
+
+	result := gdb.Model(&module.RateLimitRecord{}).
+		Select("COALESCE(model, '') AS model, "+usageCountColumns, usageCountArgs...).
+		Where("namespace = ? AND request_time >= ? AND request_time < ?",
+			namespace, from.UnixMilli(), to.UnixMilli()).
+		Clauses(groupByFirstColumn).
+		Order("requests DESC").
+		Scan(&usages)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to query usage by model: %w", result.Error)
+	}
+
+	return usages, nil
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+)
+
+// Audit 记录修改是谁在哪个请求中发起的
+type Audit struct {
+	Actor     string
+	RequestID string
+}
+
+// SystemAudit 用于没有操作人的修改
+var SystemAudit = Audit{Actor: "system"}
+
+// RecordAuditEvent 写入一个不属于数据修改的审计事件，例如登录
+func RecordAuditEvent(audit Audit, action, targetType, target string, before, after any) error {
+	return recordAudit(gdb, audit, action, targetType, target, before, after)
+}
+
+// recordAudit 在tx中写入审计事件，before和after为nil时不记录
+func recordAudit(
+	tx *gorm.DB,
+	audit Audit,
+	action, targetType, target string,
+	before, after any,
+) error {
+	event := &module.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		Target:     target,
+		Actor:      audit.Actor,
+		RequestID:  audit.RequestID,
+	}
+
+	if event.Actor == "" {
+		event.Actor = SystemAudit.Actor
+	}
+
+	var err error
+
+	if event.Before, err = auditJSON(before); err != nil {
+		return err
+	}
+
+	if event.After, err = auditJSON(after); err != nil {
+		return err
+	}
+
+	if err := tx.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event %s: %w", action, err)
+	}
+
+	return nil
+}
+
+func auditJSON(v any) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit data: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// AuditEventFilter 查询审计事件的过滤条件，为空的条件不过滤
+type AuditEventFilter struct {
+	Action     string
+	TargetType string
+	Target     string
+	Actor      string
+	RequestID  string
+	From       time.Time
+	To         time.Time
+}
+
+// ListAuditEvents 按条件分页查询审计事件，同时返回符合条件的总数
+func ListAuditEvents(
+	filter AuditEventFilter,
+	limit, offset int,
+) ([]module.AuditEvent, int64, error) {
+	tx := gdb.Model(&module.AuditEvent{})
+
+	for _, cond := range []struct{ column, value string }{
+		{"action", filter.Action},
+		{"target_type", filter.TargetType},
+		{"target", filter.Target},
+		{"actor", filter.Actor},
+		{"request_id", filter.RequestID},
+	} {
+		if cond.value != "" {
+			tx = tx.Where(cond.column+" = ?", cond.value)
+		}
+	}
+
+	if !filter.From.IsZero() {
+		tx = tx.Where("created_at >= ?", filter.From)
+	}
+
+	if !filter.To.IsZero() {
+		tx = tx.Where("created_at < ?", filter.To)
+	}
+
+	tx = tx.Session(&gorm.Session{})
+
+	var total int64
+	if result := tx.Count(&total); result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", result.Error)
+	}
+
+	var events []module.AuditEvent
+
+	result := tx.Order("id DESC").Limit(limit).Offset(offset).Find(&events)
+	if result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", result.Error)
+	}
+
+	return events, total, nil
+}
+
+// DeleteAuditEventsBefore 分批删除before之前的审计事件，返回删除的数量
+func DeleteAuditEventsBefore(before time.Time) (int64, error) {
+	deleted, err := deleteInBatches("audit_events", "created_at < ?", before)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete audit events: %w", err)
+	}
+
+	return deleted, nil
+}
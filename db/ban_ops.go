@@ -0,0 +1,100 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrBanNotFound 封禁不存在
+var ErrBanNotFound = errors.New("ban not found")
+
+// CreateBan 创建一个封禁
+func CreateBan(audit Audit, ban *module.Ban) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(ban).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionBanCreate,
+			module.AuditTargetBan,
+			strconv.FormatUint(uint64(ban.ID), 10),
+			nil,
+			ban,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to create ban for %s '%s': %w",
+			ban.TargetType,
+			ban.Target,
+			err,
+		)
+	}
+
+	return nil
+}
+
+// ListBans 查询封禁，targetType为空时查询全部类型，activeOnly只返回仍然生效的
+func ListBans(targetType string, activeOnly bool) ([]module.Ban, error) {
+	var bans []module.Ban
+
+	tx := gdb.Order("created_at DESC")
+	if targetType != "" {
+		tx = tx.Where("target_type = ?", targetType)
+	}
+
+	if activeOnly {
+		tx = tx.Where("expires_at IS NULL OR expires_at > ?", time.Now())
+	}
+
+	result := tx.Find(&bans)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list bans: %w", result.Error)
+	}
+
+	return bans, nil
+}
+
+// DeleteBan 解除封禁
+func DeleteBan(audit Audit, id uint) error {
+	var ban module.Ban
+
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{}).Delete(&ban, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionBanDelete,
+			module.AuditTargetBan,
+			strconv.FormatUint(uint64(id), 10),
+			&ban,
+			nil,
+		)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: '%d'", ErrBanNotFound, id)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete ban '%d': %w", id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoCreditAvailable = errors.New("no credit available")
+	// ErrCreditGrantNotFound 奖励额度不存在
+	ErrCreditGrantNotFound = errors.New("credit grant not found")
+)
+
+// CreateCreditGrant 创建一个奖励额度
+func CreateCreditGrant(audit Audit, grant *module.CreditGrant) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(grant).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionGrantCreate,
+			module.AuditTargetCreditGrant,
+			strconv.FormatUint(uint64(grant.ID), 10),
+			nil,
+			grant,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to create credit grant for namespace '%s': %w",
+			grant.Namespace,
+			err,
+		)
+	}
+
+	return nil
+}
+
+// ListCreditGrants 查询奖励额度，namespace为空时查询全部，activeOnly只返回当前有效且未用完的
+func ListCreditGrants(namespace string, activeOnly bool) ([]module.CreditGrant, error) {
+	var grants []module.CreditGrant
+
+	tx := gdb.Order("expires_at ASC")
+	if namespace != "" {
+		tx = tx.Where("namespace = ?", namespace)
+	}
+
+	if activeOnly {
+		now := time.Now()
+		tx = tx.Where("starts_at <= ? AND expires_at > ? AND used < amount", now, now)
+	}
+
+	result := tx.Find(&grants)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list credit grants: %w", result.Error)
+	}
+
+	return grants, nil
+}
+
+// DeleteCreditGrant 删除奖励额度，已经消耗该额度的请求记录保持不变
+func DeleteCreditGrant(audit Audit, id uint) error {
+	var grant module.CreditGrant
+
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{}).Delete(&grant, id)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionGrantDelete,
+			module.AuditTargetCreditGrant,
+			strconv.FormatUint(uint64(id), 10),
+			&grant,
+			nil,
+		)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: '%d'", ErrCreditGrantNotFound, id)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete credit grant '%d': %w", id, err)
+	}
+
+	return nil
+}
+
+// AddCreditRequest 消耗一次奖励额度并插入请求记录，优先消耗最早过期的额度，
+// 没有可用额度时返回ErrNoCreditAvailable。并发请求会等待同一个额度的行锁，
+// 拿到锁后Postgres重新检查条件，额度已用完时取下一个额度，所以不会误判为没有额度
+func AddCreditRequest(namespace, model string) (uint, error) {
+	var recordID uint
+
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var grant module.CreditGrant
+
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("namespace = ? AND starts_at <= ? AND expires_at > ? AND used < amount",
+				namespace, now, now).
+			Order("expires_at ASC").
+			First(&grant)
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrNoCreditAvailable
+			}
+			return result.Error
+		}
+
+		result = tx.Model(&grant).Update("used", gorm.Expr("used + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		record := &module.RateLimitRecord{
+			Namespace:     namespace,
+			RequestTime:   now.UnixMilli(),
+			Status:        module.RateLimitStatusCounted,
+			Model:         model,
+			CreditGrantID: &grant.ID,
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+
+		recordID = record.ID
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrNoCreditAvailable) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to add credit request record: %w", err)
+	}
+
+	return recordID, nil
+}
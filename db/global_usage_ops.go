@@ -0,0 +1,85 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GlobalDayPeriod 返回某个时间所在的日统计周期
+func GlobalDayPeriod(t time.Time) string {
+	return "day:" + t.Format(time.DateOnly)
+}
+
+// GlobalMonthPeriod 返回某个时间所在的月统计周期
+func GlobalMonthPeriod(t time.Time) string {
+	return "month:" + t.Format("2006-01")
+}
+
+// GetGlobalUsage 查询某个时间所在的日和月的全局用量，没有记录时返回空用量
+func GetGlobalUsage(t time.Time) (day, month module.GlobalUsage, err error) {
+	dayPeriod := GlobalDayPeriod(t)
+	monthPeriod := GlobalMonthPeriod(t)
+
+	var usages []module.GlobalUsage
+
+	result := gdb.Where("period IN ?", []string{dayPeriod, monthPeriod}).Find(&usages)
+	if result.Error != nil {
+		return day, month, fmt.Errorf("failed to get global usage: %w", result.Error)
+	}
+
+	day.Period = dayPeriod
+	month.Period = monthPeriod
+
+	for _, usage := range usages {
+		switch usage.Period {
+		case dayPeriod:
+			day = usage
+		case monthPeriod:
+			month = usage
+		}
+	}
+
+	return day, month, nil
+}
+
+// IncrGlobalUsage 累加某个时间所在的日和月的全局用量，传入负数表示退还
+func IncrGlobalUsage(t time.Time, requests, tokens int64) error {
+	usages := []module.GlobalUsage{
+		{Period: GlobalDayPeriod(t), Requests: requests, Tokens: tokens},
+		{Period: GlobalMonthPeriod(t), Requests: requests, Tokens: tokens},
+	}
+
+	result := gdb.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"requests":   gorm.Expr("global_usages.requests + excluded.requests"),
+			"tokens":     gorm.Expr("global_usages.tokens + excluded.tokens"),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&usages)
+	if result.Error != nil {
+		return fmt.Errorf("failed to increase global usage: %w", result.Error)
+	}
+
+	return nil
+}
+
+// MarkGlobalUsageAlerted 标记某个周期已经告警，只有第一次标记成功时返回true，保证多副本只告警一次
+func MarkGlobalUsageAlerted(period string) (bool, error) {
+	result := gdb.Model(&module.GlobalUsage{}).
+		Where("period = ? AND alerted_at IS NULL", period).
+		Update("alerted_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf(
+			"failed to mark global usage '%s' alerted: %w",
+			period,
+			result.Error,
+		)
+	}
+
+	return result.RowsAffected > 0, nil
+}
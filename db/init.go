@@ -3,15 +3,25 @@
 package db
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
+	"github.com/labring/aiproxy-free/config"
 	"github.com/labring/aiproxy-free/module"
 	"gorm.io/gorm"
 )
 
-var gdb *gorm.DB
+var (
+	gdb       *gorm.DB
+	cancelGDB context.CancelFunc
+)
 
 func InitDatabase(dsn string) error {
+	if config.KeyHashSecret == "" {
+		return errors.New("KEY_HASH_SECRET is required")
+	}
+
 	db, err := OpenPostgreSQL(dsn)
 	if err != nil {
 		return err
@@ -23,10 +33,19 @@ func InitDatabase(dsn string) error {
 
 	gdb = db
 
+	var ctx context.Context
+	ctx, cancelGDB = context.WithCancel(context.Background())
+
+	initNamespaceCache(ctx, dsn)
+
 	return nil
 }
 
 func Close() error {
+	if cancelGDB != nil {
+		cancelGDB()
+	}
+
 	idb, err := gdb.DB()
 	if err != nil {
 		return err
@@ -36,9 +55,22 @@ func Close() error {
 }
 
 func migrateDB(db *gorm.DB) error {
+	if err := migrateKeyMappingHashes(db); err != nil {
+		return fmt.Errorf("migrate key mapping hashes failed: %w", err)
+	}
+
 	err := db.AutoMigrate(
 		&module.RateLimitRecord{},
 		&module.KeyMapping{},
+		&module.IPRateLimitRecord{},
+		&module.CreditGrant{},
+		&module.GlobalUsage{},
+		&module.Ban{},
+		&module.QuotaAdjustment{},
+		&module.AuditEvent{},
+		&module.WebhookDelivery{},
+		&module.Plan{},
+		&module.ShadowDecision{},
 	)
 	if err != nil {
 		return err
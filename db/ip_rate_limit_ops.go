@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+)
+
+// AddIPRequest 插入一个来源IP的请求记录
+func AddIPRequest(ip string) error {
+	record := &module.IPRateLimitRecord{
+		IP:          ip,
+		RequestTime: time.Now().UnixMilli(),
+	}
+
+	result := gdb.Create(record)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add ip request record: %w", result.Error)
+	}
+
+	return nil
+}
+
+// CountIPRequestsToday 查询某个来源IP在今天的请求数量
+func CountIPRequestsToday(ip string) (int64, error) {
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).
+		UnixMilli()
+	endOfDay := startOfDay + 24*60*60*1000 - 1
+
+	var count int64
+
+	result := gdb.Model(&module.IPRateLimitRecord{}).
+		Where("ip = ? AND request_time >= ? AND request_time <= ?", ip, startOfDay, endOfDay).
+		Count(&count)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count ip requests today: %w", result.Error)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/labring/aiproxy-free/config"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const keyPrefixLength = 8
+
+// HashKey 使用服务端密钥计算key的HMAC-SHA256，数据库中只保存该值
+func HashKey(key string) string {
+	mac := hmac.New(sha256.New, []byte(config.KeyHashSecret))
+	mac.Write([]byte(key))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// KeyPrefix 返回key的前缀用于展示和日志，短key只保留一半避免泄露，
+// 本地签发的key额外保留固定前缀之后的几位以便区分
+func KeyPrefix(key string) string {
+	n := keyPrefixLength
+	if config.LocalKeyPrefix != "" && strings.HasPrefix(key, config.LocalKeyPrefix) {
+		n += len(config.LocalKeyPrefix)
+	}
+
+	n = min(n, len(key)/2)
+
+	return key[:n] + "..."
+}
+
+// migrateKeyMappingHashes 将旧版本以明文key为主键的key_mappings转换为HMAC主键，
+// 在AutoMigrate之前执行，已经转换过的表直接跳过
+func migrateKeyMappingHashes(db *gorm.DB) error {
+	if !db.Migrator().HasTable("key_mappings") ||
+		!db.Migrator().HasColumn("key_mappings", "key") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// 多个副本同时启动时只有一个副本执行转换
+		if err := tx.Exec("LOCK TABLE key_mappings IN ACCESS EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		if !tx.Migrator().HasColumn("key_mappings", "key") {
+			return nil
+		}
+
+		err := tx.Exec(`ALTER TABLE key_mappings
+			ADD COLUMN IF NOT EXISTS key_hash varchar(64),
+			ADD COLUMN IF NOT EXISTS key_prefix varchar(32)`).Error
+		if err != nil {
+			return err
+		}
+
+		var keys []string
+		if err := tx.Table("key_mappings").Pluck("key", &keys).Error; err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			err := tx.Table("key_mappings").
+				Where("key = ?", key).
+				Updates(map[string]any{
+					"key_hash":   HashKey(key),
+					"key_prefix": KeyPrefix(key),
+				}).Error
+			if err != nil {
+				return fmt.Errorf("failed to hash key %s: %w", KeyPrefix(key), err)
+			}
+		}
+
+		for _, stmt := range []string{
+			"ALTER TABLE key_mappings DROP CONSTRAINT IF EXISTS key_mappings_pkey",
+			"ALTER TABLE key_mappings DROP COLUMN key",
+			"ALTER TABLE key_mappings ADD PRIMARY KEY (key_hash)",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		log.Infof("Migrated %d plaintext keys in key_mappings to hashes", len(keys))
+
+		return nil
+	})
+}
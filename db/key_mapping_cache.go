@@ -0,0 +1,93 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/utils/lru"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	keyMappingInvalidationChannel = "key_mapping_invalidation"
+	invalidationRetryInterval     = 5 * time.Second
+)
+
+// namespaceCache 进程内key到namespace映射的缓存，为nil时不缓存
+var namespaceCache *lru.Cache[string, module.KeyMapping]
+
+// NamespaceCacheStats 返回key到namespace缓存的命中统计
+func NamespaceCacheStats() lru.Stats {
+	return namespaceCache.Stats()
+}
+
+func initNamespaceCache(ctx context.Context, dsn string) {
+	namespaceCache = lru.New[string, module.KeyMapping](
+		int(config.KeyCacheSize),
+		config.KeyCacheTTL,
+	)
+	if namespaceCache == nil {
+		return
+	}
+
+	go listenKeyMappingInvalidation(ctx, dsn)
+}
+
+// invalidateNamespaceCache 删除本副本的缓存并通知其他副本删除
+func invalidateNamespaceCache(key string) {
+	if namespaceCache == nil {
+		return
+	}
+
+	namespaceCache.Remove(key)
+
+	err := gdb.Exec("SELECT pg_notify(?, ?)", keyMappingInvalidationChannel, key).Error
+	if err != nil {
+		log.Errorf("Failed to notify key mapping invalidation: %v", err)
+	}
+}
+
+// listenKeyMappingInvalidation 通过LISTEN接收其他副本的缓存失效通知，断线期间可能丢失通知，
+// 所以每次重新连接后清空缓存
+func listenKeyMappingInvalidation(ctx context.Context, dsn string) {
+	for {
+		err := waitKeyMappingInvalidation(ctx, dsn)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Errorf("Key mapping invalidation listener stopped: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(invalidationRetryInterval):
+		}
+	}
+}
+
+func waitKeyMappingInvalidation(ctx context.Context, dsn string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+keyMappingInvalidationChannel); err != nil {
+		return err
+	}
+
+	namespaceCache.Purge()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		namespaceCache.Remove(notification.Payload)
+	}
+}
@@ -3,72 +3,240 @@ package db
 import (
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/labring/aiproxy-free/module"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// GetNamespace 查询某个key对应的namespace
-func GetNamespace(key string) (string, error) {
+// ErrMappingNotFound key没有对应的映射
+var ErrMappingNotFound = errors.New("key mapping not found")
+
+// GetNamespace 查询某个key对应的namespace，优先从进程内缓存读取
+func GetNamespace(keyHash string) (string, error) {
+	mapping, err := GetMapping(keyHash)
+	if err != nil {
+		return "", err
+	}
+
+	return mapping.Namespace, nil
+}
+
+// GetMapping 查询某个key的映射，优先从进程内缓存读取
+func GetMapping(keyHash string) (*module.KeyMapping, error) {
+	if mapping, ok := namespaceCache.Get(keyHash); ok {
+		return &mapping, nil
+	}
+
 	var mapping module.KeyMapping
 
-	result := gdb.Where("key = ?", key).First(&mapping)
+	result := gdb.Where("key_hash = ?", keyHash).First(&mapping)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return "", fmt.Errorf("key '%s' not found", key)
+			return nil, errMappingNotFound(keyHash)
 		}
-		return "", fmt.Errorf("failed to get namespace for key '%s': %w", key, result.Error)
+		return nil, fmt.Errorf("failed to get namespace for key hash '%s': %w", keyHash, result.Error)
 	}
 
-	return mapping.Namespace, nil
+	namespaceCache.Add(keyHash, mapping)
+
+	return &mapping, nil
 }
 
 // SaveMapping 保存key与namespace的对应关系（使用Save保证已存在也不报错）
-func SaveMapping(key, namespace string) error {
+func SaveMapping(audit Audit, keyHash, keyPrefix, namespace, source string) error {
 	mapping := &module.KeyMapping{
-		Key:       key,
-		Namespace: namespace,
+		KeyHash:         keyHash,
+		KeyPrefix:       keyPrefix,
+		Namespace:       namespace,
+		Source:          source,
+		LastValidatedAt: time.Now(),
 	}
 
-	result := gdb.Save(mapping)
-	if result.Error != nil {
-		return fmt.Errorf("failed to save mapping for key '%s': %w", key, result.Error)
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		before, err := findMapping(tx, keyHash)
+		if err != nil {
+			return err
+		}
+
+		// 管理员固定的映射不会被resolver的结果覆盖
+		if before != nil && before.Pinned {
+			mapping.Namespace = before.Namespace
+			mapping.Pinned = true
+		}
+
+		if before == nil || before.Namespace != mapping.Namespace {
+			if err := enqueueNamespaceCreated(tx, mapping); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Save(mapping).Error; err != nil {
+			return err
+		}
+
+		action := module.AuditActionKeyMappingCreate
+		if before != nil {
+			action = module.AuditActionKeyMappingUpdate
+		}
+
+		return recordMappingAudit(tx, audit, action, keyHash, before, mapping)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save mapping for key hash '%s': %w", keyHash, err)
 	}
 
+	invalidateNamespaceCache(keyHash)
+
 	return nil
 }
 
-// UpdateMapping 更新已存在的key的namespace映射
-func UpdateMapping(key, namespace string) error {
-	result := gdb.Model(&module.KeyMapping{}).
-		Where("key = ?", key).
-		Update("namespace", namespace)
+// CreateMapping 创建一个新的key映射，key已存在时返回错误
+func CreateMapping(audit Audit, mapping *module.KeyMapping) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		if err := enqueueNamespaceCreated(tx, mapping); err != nil {
+			return err
+		}
 
-	if result.Error != nil {
-		return fmt.Errorf("failed to update mapping for key '%s': %w", key, result.Error)
+		if err := tx.Create(mapping).Error; err != nil {
+			return err
+		}
+
+		return recordMappingAudit(
+			tx,
+			audit,
+			module.AuditActionKeyMappingCreate,
+			mapping.KeyHash,
+			nil,
+			mapping,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to create mapping for key %s: %w",
+			mapping.KeyPrefix,
+			err,
+		)
 	}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("key '%s' not found", key)
+	return nil
+}
+
+// ImportMapping 导入一个完整的key映射，已存在时覆盖
+func ImportMapping(audit Audit, mapping *module.KeyMapping) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		before, err := findMapping(tx, mapping.KeyHash)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Save(mapping).Error; err != nil {
+			return err
+		}
+
+		return recordMappingAudit(
+			tx,
+			audit,
+			module.AuditActionKeyMappingImport,
+			mapping.KeyHash,
+			before,
+			mapping,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to import mapping for key hash '%s': %w",
+			mapping.KeyHash,
+			err,
+		)
 	}
 
+	invalidateNamespaceCache(mapping.KeyHash)
+
 	return nil
 }
 
-// DeleteMapping 删除key映射
-func DeleteMapping(key string) error {
-	result := gdb.Delete(&module.KeyMapping{}, "key = ?", key)
+// UpdateMapping 更新已存在的key的namespace映射，pinned为true时重新校验不再修改这个namespace
+func UpdateMapping(audit Audit, keyHash, namespace string, pinned bool) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		before, err := findMapping(tx.Clauses(clause.Locking{Strength: "UPDATE"}), keyHash)
+		if err != nil {
+			return err
+		}
+
+		if before == nil {
+			return errMappingNotFound(keyHash)
+		}
+
+		after := *before
+		after.Namespace = namespace
+		after.Pinned = pinned
+
+		if before.Namespace != namespace {
+			if err := enqueueNamespaceCreated(tx, &after); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(&module.KeyMapping{}).
+			Where("key_hash = ?", keyHash).
+			Updates(map[string]any{"namespace": namespace, "pinned": pinned})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return recordMappingAudit(
+			tx,
+			audit,
+			module.AuditActionKeyMappingUpdate,
+			keyHash,
+			before,
+			&after,
+		)
+	})
+	if err != nil {
+		if errors.Is(err, ErrMappingNotFound) {
+			return err
+		}
+
+		return fmt.Errorf("failed to update mapping for key hash '%s': %w", keyHash, err)
+	}
+
+	invalidateNamespaceCache(keyHash)
+
+	return nil
+}
+
+// TouchMappingValidated 记录key刚刚向上游确认过仍然有效
+func TouchMappingValidated(keyHash string) error {
+	result := gdb.Model(&module.KeyMapping{}).
+		Where("key_hash = ?", keyHash).
+		Update("last_validated_at", time.Now())
+
 	if result.Error != nil {
-		return fmt.Errorf("failed to delete mapping for key '%s': %w", key, result.Error)
+		return fmt.Errorf(
+			"failed to update last validated time for key hash '%s': %w",
+			keyHash,
+			result.Error,
+		)
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("key '%s' not found", key)
+		return errMappingNotFound(keyHash)
 	}
 
+	invalidateNamespaceCache(keyHash)
+
 	return nil
 }
 
+// DeleteMapping 删除key映射
+func DeleteMapping(audit Audit, keyHash string) error {
+	return deleteMapping(audit, keyHash, "key_hash = ?", keyHash)
+}
+
 // ListMappingsByNamespace 根据namespace查询所有相关的key映射
 func ListMappingsByNamespace(namespace string) ([]module.KeyMapping, error) {
 	var mappings []module.KeyMapping
@@ -85,13 +253,108 @@ func ListMappingsByNamespace(namespace string) ([]module.KeyMapping, error) {
 	return mappings, nil
 }
 
+// ListMappingsBySource 查询某个来源的所有key映射，namespace为空时不过滤namespace
+func ListMappingsBySource(source, namespace string) ([]module.KeyMapping, error) {
+	var mappings []module.KeyMapping
+
+	tx := gdb.Where("source = ?", source).Order("created_at DESC")
+	if namespace != "" {
+		tx = tx.Where("namespace = ?", namespace)
+	}
+
+	result := tx.Find(&mappings)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list mappings for source '%s': %w", source, result.Error)
+	}
+
+	return mappings, nil
+}
+
+// DeleteMappingBySource 删除某个来源的key映射，用于吊销本地签发的key
+func DeleteMappingBySource(audit Audit, keyHash, source string) error {
+	return deleteMapping(audit, keyHash, "key_hash = ? AND source = ?", keyHash, source)
+}
+
+func deleteMapping(audit Audit, keyHash, query string, args ...any) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		var deleted []module.KeyMapping
+
+		result := tx.Clauses(clause.Returning{}).Where(query, args...).Delete(&deleted)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return errMappingNotFound(keyHash)
+		}
+
+		return recordMappingAudit(
+			tx,
+			audit,
+			module.AuditActionKeyMappingDelete,
+			keyHash,
+			&deleted[0],
+			nil,
+		)
+	})
+	if err != nil {
+		if errors.Is(err, ErrMappingNotFound) {
+			return err
+		}
+
+		return fmt.Errorf("failed to delete mapping for key hash '%s': %w", keyHash, err)
+	}
+
+	invalidateNamespaceCache(keyHash)
+
+	return nil
+}
+
+// findMapping 在tx中查询key映射，不存在时返回nil，不经过缓存
+func findMapping(tx *gorm.DB, keyHash string) (*module.KeyMapping, error) {
+	var mappings []module.KeyMapping
+
+	if err := tx.Where("key_hash = ?", keyHash).Limit(1).Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+
+	if len(mappings) == 0 {
+		return nil, nil
+	}
+
+	return &mappings[0], nil
+}
+
+func errMappingNotFound(keyHash string) error {
+	return fmt.Errorf("%w: key hash '%s'", ErrMappingNotFound, keyHash)
+}
+
+// recordMappingAudit 记录key映射的修改，before和after为nil时不记录对应的一侧
+func recordMappingAudit(
+	tx *gorm.DB,
+	audit Audit,
+	action, keyHash string,
+	before, after *module.KeyMapping,
+) error {
+	var beforeData, afterData any
+	if before != nil {
+		beforeData = before
+	}
+
+	if after != nil {
+		afterData = after
+	}
+
+	return recordAudit(tx, audit, action, module.AuditTargetKey, keyHash, beforeData, afterData)
+}
+
 // KeyExists 检查key是否存在
-func KeyExists(key string) (bool, error) {
+func KeyExists(keyHash string) (bool, error) {
 	var count int64
 
-	result := gdb.Model(&module.KeyMapping{}).Where("key = ?", key).Count(&count)
+	result := gdb.Model(&module.KeyMapping{}).Where("key_hash = ?", keyHash).Count(&count)
 	if result.Error != nil {
-		return false, fmt.Errorf("failed to check if key '%s' exists: %w", key, result.Error)
+		return false, fmt.Errorf("failed to check if key hash '%s' exists: %w", keyHash, result.Error)
 	}
 
 	return count > 0, nil
@@ -109,18 +372,65 @@ func CountKeysByNamespace(namespace string) (int64, error) {
 	return count, nil
 }
 
-// GetAllMappings 获取所有映射（分页）
-func GetAllMappings(limit, offset int) ([]module.KeyMapping, error) {
+// MappingCursor 按(created_at, key_hash)倒序遍历key映射时上一页最后一行的位置
+type MappingCursor struct {
+	CreatedAt time.Time
+	KeyHash   string
+}
+
+// ListMappingsAfter 按(created_at, key_hash)倒序查询cursor之后的一页key映射，
+// cursor为nil时从头开始，遍历期间新增或者删除的映射不会导致其他映射被跳过或者重复
+func ListMappingsAfter(cursor *MappingCursor, limit int) ([]module.KeyMapping, error) {
+	tx := gdb.Order("created_at DESC, key_hash DESC").Limit(limit)
+	if cursor != nil {
+		tx = tx.Where("(created_at, key_hash) < (?, ?)", cursor.CreatedAt, cursor.KeyHash)
+	}
+
 	var mappings []module.KeyMapping
 
-	result := gdb.Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&mappings)
+	if result := tx.Find(&mappings); result.Error != nil {
+		return nil, fmt.Errorf("failed to list mappings: %w", result.Error)
+	}
+
+	return mappings, nil
+}
+
+// MappingFilter 查询key映射的过滤条件，为空的条件不过滤
+type MappingFilter struct {
+	Namespace string
+	// KeyPrefix 匹配以此开头的key前缀
+	KeyPrefix string
+}
+
+// ListMappings 按条件分页查询key映射，同时返回符合条件的总数
+func ListMappings(filter MappingFilter, limit, offset int) ([]module.KeyMapping, int64, error) {
+	tx := gdb.Model(&module.KeyMapping{})
+	if filter.Namespace != "" {
+		tx = tx.Where("namespace = ?", filter.Namespace)
+	}
+
+	if filter.KeyPrefix != "" {
+		tx = tx.Where("key_prefix LIKE ? ESCAPE '\\'", escapeLike(filter.KeyPrefix)+"%")
+	}
 
+	// 计数和查询共用同一组条件
+	tx = tx.Session(&gorm.Session{})
+
+	var total int64
+	if result := tx.Count(&total); result.Error != nil {
+		return nil, 0, fmt.Errorf("failed to count mappings: %w", result.Error)
+	}
+
+	var mappings []module.KeyMapping
+
+	result := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&mappings)
 	if result.Error != nil {
-		return nil, fmt.Errorf("failed to get all mappings: %w", result.Error)
+		return nil, 0, fmt.Errorf("failed to list mappings: %w", result.Error)
 	}
 
-	return mappings, nil
+	return mappings, total, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
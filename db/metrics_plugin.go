@@ -0,0 +1,76 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/metrics"
+	"gorm.io/gorm"
+)
+
+const metricsBeginKey = "metrics:begin"
+
+// metricsPlugin 通过gorm回调记录每条SQL的耗时，只读取Statement中生成的SQL，
+// 不会像logger的Trace那样为了拿到SQL而展开参数
+type metricsPlugin struct{}
+
+func (metricsPlugin) Name() string {
+	return "metrics"
+}
+
+func (metricsPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("metrics:before_create", beginQuery),
+		cb.Create().After("gorm:create").Register("metrics:after_create", observeQuery),
+		cb.Query().Before("gorm:query").Register("metrics:before_query", beginQuery),
+		cb.Query().After("gorm:query").Register("metrics:after_query", observeQuery),
+		cb.Update().Before("gorm:update").Register("metrics:before_update", beginQuery),
+		cb.Update().After("gorm:update").Register("metrics:after_update", observeQuery),
+		cb.Delete().Before("gorm:delete").Register("metrics:before_delete", beginQuery),
+		cb.Delete().After("gorm:delete").Register("metrics:after_delete", observeQuery),
+		cb.Row().Before("gorm:row").Register("metrics:before_row", beginQuery),
+		cb.Row().After("gorm:row").Register("metrics:after_row", observeQuery),
+		cb.Raw().Before("gorm:raw").Register("metrics:before_raw", beginQuery),
+		cb.Raw().After("gorm:raw").Register("metrics:after_raw", observeQuery),
+	)
+}
+
+func beginQuery(db *gorm.DB) {
+	db.InstanceSet(metricsBeginKey, time.Now())
+}
+
+func observeQuery(db *gorm.DB) {
+	if db.DryRun {
+		return
+	}
+
+	v, _ := db.InstanceGet(metricsBeginKey)
+
+	begin, ok := v.(time.Time)
+	if !ok {
+		return
+	}
+
+	result := "ok"
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		result = "error"
+	}
+
+	metrics.DBQueryDuration.WithLabelValues(sqlOperation(db.Statement.SQL.String()), result).
+		Observe(metrics.Since(begin))
+}
+
+// sqlOperation 返回SQL的第一个关键字作为标签，避免把SQL本身作为标签
+func sqlOperation(sql string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+
+	switch keyword = strings.ToLower(keyword); keyword {
+	case "select", "insert", "update", "delete", "with":
+		return keyword
+	default:
+		return "other"
+	}
+}
@@ -12,7 +12,7 @@ import (
 )
 
 func OpenPostgreSQL(dsn string) (*gorm.DB, error) {
-	return gorm.Open(postgres.New(postgres.Config{
+	db, err := gorm.Open(postgres.New(postgres.Config{
 		DSN:                  dsn,
 		PreferSimpleProtocol: true, // disables implicit prepared statement usage
 	}), &gorm.Config{
@@ -22,6 +22,15 @@ func OpenPostgreSQL(dsn string) (*gorm.DB, error) {
 		DisableForeignKeyConstraintWhenMigrating: false,
 		IgnoreRelationshipsWhenMigrating:         false,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Use(metricsPlugin{}); err != nil {
+		return nil, err
+	}
+
+	return db, nil
 }
 
 func newDBLogger() gormLogger.Interface {
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/utils/snapshot"
+	log "github.com/sirupsen/logrus"
+)
+
+// plans 保存的默认计划的快照，每config.PlanRefreshInterval重新加载，
+// 这样其他副本修改的计划也会生效，为空表示没有保存过计划
+var plans = snapshot.New(
+	func() (*module.Plan, error) {
+		plan, err := GetPlan(module.PlanDefault)
+		if errors.Is(err, ErrPlanNotFound) {
+			return nil, nil
+		}
+
+		return plan, err
+	},
+	func() time.Duration { return config.PlanRefreshInterval },
+)
+
+// EnforcedLimitPolicy 返回拒绝请求时使用的限额，保存的计划优先于环境变量中配置的限额
+func EnforcedLimitPolicy() config.LimitPolicy {
+	plan := CurrentPlan()
+	if plan == nil {
+		return config.EnforcedLimitPolicy()
+	}
+
+	return config.LimitPolicy{
+		DailyRequestLimit:   plan.DailyRequestLimit,
+		MonthlyRequestLimit: plan.MonthlyRequestLimit,
+		MonthlyLimitMode:    plan.MonthlyLimitMode,
+	}
+}
+
+// CurrentPlan 返回缓存的默认计划，没有保存过计划时返回nil，加载失败时继续使用旧的计划
+func CurrentPlan() *module.Plan {
+	plan, err := plans.Get()
+	if err != nil {
+		log.Errorf("Failed to load plan: %v", err)
+	}
+
+	return plan
+}
+
+// invalidatePlanCache 删除本副本缓存的计划，其他副本在下次刷新时生效
+func invalidatePlanCache() {
+	plans.Invalidate()
+}
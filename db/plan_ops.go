@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPlanNotFound 计划没有保存过，使用环境变量中配置的限额
+var ErrPlanNotFound = errors.New("plan not found")
+
+// GetPlan 查询保存的计划
+func GetPlan(id string) (*module.Plan, error) {
+	var plan module.Plan
+
+	err := gdb.Where("id = ?", id).First(&plan).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPlanNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan '%s': %w", id, err)
+	}
+
+	return &plan, nil
+}
+
+// SavePlan 创建或者覆盖计划，并记录修改前后的限额
+func SavePlan(audit Audit, plan *module.Plan) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		var (
+			existing module.Plan
+			before   *module.Plan
+		)
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", plan.ID).
+			First(&existing).Error
+
+		switch {
+		case err == nil:
+			before = &existing
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "id"}},
+			UpdateAll: true,
+		}).Create(plan).Error
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionPlanUpdate,
+			module.AuditTargetPlan,
+			plan.ID,
+			before,
+			plan,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save plan '%s': %w", plan.ID, err)
+	}
+
+	invalidatePlanCache()
+
+	return nil
+}
+
+// DeletePlan 删除保存的计划，之后重新使用环境变量中配置的限额
+func DeletePlan(audit Audit, id string) error {
+	var plan module.Plan
+
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Returning{}).Where("id = ?", id).Delete(&plan)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrPlanNotFound
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionPlanDelete,
+			module.AuditTargetPlan,
+			id,
+			&plan,
+			nil,
+		)
+	})
+	if errors.Is(err, ErrPlanNotFound) {
+		return err
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to delete plan '%s': %w", id, err)
+	}
+
+	invalidatePlanCache()
+
+	return nil
+}
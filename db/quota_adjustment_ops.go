@@ -0,0 +1,169 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+)
+
+// quotaWindow 返回额度窗口的毫秒时间范围，与CountRequestsToday和CountRequestsThisMonth一致
+func quotaWindow(now time.Time, window string) (start, end int64) {
+	if window == module.QuotaWindowMonth {
+		return monthlyWindow(now, EnforcedLimitPolicy().MonthlyLimitMode).UnixMilli(), now.UnixMilli()
+	}
+
+	start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).UnixMilli()
+
+	return start, start + 24*60*60*1000 - 1
+}
+
+// countedInWindow 查询窗口内计入该窗口额度的记录，不包括消耗奖励额度的请求
+func countedInWindow(tx *gorm.DB, namespace, window string) *gorm.DB {
+	start, end := quotaWindow(time.Now(), window)
+
+	statuses := []string{module.RateLimitStatusCounted}
+	if window == module.QuotaWindowMonth {
+		statuses = monthlyCountedStatuses
+	}
+
+	return tx.Model(&module.RateLimitRecord{}).
+		Where("namespace = ? AND request_time >= ? AND request_time <= ?", namespace, start, end).
+		Where("credit_grant_id IS NULL AND status IN ?", statuses)
+}
+
+// voidedStatus 作废窗口内记录时使用的状态，每日窗口的作废不能影响月度额度
+func voidedStatus(window string) string {
+	if window == module.QuotaWindowMonth {
+		return module.RateLimitStatusVoided
+	}
+
+	return module.RateLimitStatusDayVoided
+}
+
+// ListCountedRequests 查询某个namespace在额度窗口内计入额度的请求记录
+func ListCountedRequests(namespace, window string) ([]module.RateLimitRecord, error) {
+	var records []module.RateLimitRecord
+
+	result := countedInWindow(gdb, namespace, window).Order("request_time ASC").Find(&records)
+	if result.Error != nil {
+		return nil, fmt.Errorf(
+			"failed to list counted requests for namespace '%s': %w",
+			namespace,
+			result.Error,
+		)
+	}
+
+	return records, nil
+}
+
+// ResetQuota 作废某个namespace在额度窗口内的全部记录并写入审计记录
+func ResetQuota(audit Audit, adjustment *module.QuotaAdjustment) error {
+	adjustment.Action = module.QuotaAdjustmentReset
+	adjustment.Amount = 0
+
+	return applyQuotaAdjustment(audit, adjustment, func(tx *gorm.DB) (int64, error) {
+		result := countedInWindow(tx, adjustment.Namespace, adjustment.Window).
+			Update("status", voidedStatus(adjustment.Window))
+
+		return result.RowsAffected, result.Error
+	})
+}
+
+// AddQuotaUsage 为某个namespace增加amount次已用额度并写入审计记录
+func AddQuotaUsage(audit Audit, adjustment *module.QuotaAdjustment) error {
+	adjustment.Action = module.QuotaAdjustmentAdd
+
+	return applyQuotaAdjustment(audit, adjustment, func(tx *gorm.DB) (int64, error) {
+		now := time.Now().UnixMilli()
+
+		records := make([]module.RateLimitRecord, adjustment.Amount)
+		for i := range records {
+			records[i] = module.RateLimitRecord{
+				Namespace:   adjustment.Namespace,
+				RequestTime: now,
+				Status:      module.RateLimitStatusCounted,
+			}
+		}
+
+		result := tx.CreateInBatches(records, 500)
+
+		return result.RowsAffected, result.Error
+	})
+}
+
+// SubtractQuotaUsage 作废某个namespace在额度窗口内最近的amount条记录并写入审计记录，
+// 记录不足时只作废已有的记录
+func SubtractQuotaUsage(audit Audit, adjustment *module.QuotaAdjustment) error {
+	adjustment.Action = module.QuotaAdjustmentSubtract
+
+	return applyQuotaAdjustment(audit, adjustment, func(tx *gorm.DB) (int64, error) {
+		ids := countedInWindow(tx, adjustment.Namespace, adjustment.Window).
+			Select("id").
+			Order("request_time DESC").
+			Limit(int(adjustment.Amount))
+
+		result := tx.Model(&module.RateLimitRecord{}).
+			Where("id IN (?)", ids).
+			Update("status", voidedStatus(adjustment.Window))
+
+		return result.RowsAffected, result.Error
+	})
+}
+
+func applyQuotaAdjustment(
+	audit Audit,
+	adjustment *module.QuotaAdjustment,
+	apply func(tx *gorm.DB) (int64, error),
+) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		affected, err := apply(tx)
+		if err != nil {
+			return err
+		}
+
+		adjustment.Affected = affected
+
+		if err := tx.Create(adjustment).Error; err != nil {
+			return err
+		}
+
+		return recordAudit(
+			tx,
+			audit,
+			module.AuditActionQuotaAdjust,
+			module.AuditTargetNamespace,
+			adjustment.Namespace,
+			nil,
+			adjustment,
+		)
+	})
+	if err != nil {
+		return fmt.Errorf(
+			"failed to %s quota for namespace '%s': %w",
+			adjustment.Action,
+			adjustment.Namespace,
+			err,
+		)
+	}
+
+	return nil
+}
+
+// ListQuotaAdjustments 查询额度调整的审计记录，namespace为空时查询全部
+func ListQuotaAdjustments(namespace string, limit, offset int) ([]module.QuotaAdjustment, error) {
+	var adjustments []module.QuotaAdjustment
+
+	tx := gdb.Order("created_at DESC").Limit(limit).Offset(offset)
+	if namespace != "" {
+		tx = tx.Where("namespace = ?", namespace)
+	}
+
+	result := tx.Find(&adjustments)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list quota adjustments: %w", result.Error)
+	}
+
+	return adjustments, nil
+}
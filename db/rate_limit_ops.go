@@ -5,15 +5,19 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/labring/aiproxy-free/config"
 	"github.com/labring/aiproxy-free/module"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // AddRequest 插入一个请求记录，返回记录ID
-func AddRequest(namespace string) (uint, error) {
+func AddRequest(namespace, model string) (uint, error) {
 	record := &module.RateLimitRecord{
 		Namespace:   namespace,
 		RequestTime: time.Now().UnixMilli(),
+		Status:      module.RateLimitStatusCounted,
+		Model:       model,
 	}
 
 	result := gdb.Create(record)
@@ -24,7 +28,24 @@ func AddRequest(namespace string) (uint, error) {
 	return record.ID, nil
 }
 
-// CountRequestsToday 查询某个namespace在今天的请求数量
+// AddRejectedRequest 插入一个被限流拒绝的请求记录，不计入额度
+func AddRejectedRequest(namespace, model string) error {
+	record := &module.RateLimitRecord{
+		Namespace:   namespace,
+		RequestTime: time.Now().UnixMilli(),
+		Status:      module.RateLimitStatusRejected,
+		Model:       model,
+	}
+
+	result := gdb.Create(record)
+	if result.Error != nil {
+		return fmt.Errorf("failed to add rejected request record: %w", result.Error)
+	}
+
+	return nil
+}
+
+// CountRequestsToday 查询某个namespace在今天消耗每日额度的请求数量（不包括消耗奖励额度的请求）
 func CountRequestsToday(namespace string) (int64, error) {
 	now := time.Now()
 	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).
@@ -35,6 +56,7 @@ func CountRequestsToday(namespace string) (int64, error) {
 
 	result := gdb.Model(&module.RateLimitRecord{}).
 		Where("namespace = ? AND request_time >= ? AND request_time <= ?", namespace, startOfDay, endOfDay).
+		Where("credit_grant_id IS NULL AND status = ?", module.RateLimitStatusCounted).
 		Count(&count)
 
 	if result.Error != nil {
@@ -44,11 +66,31 @@ func CountRequestsToday(namespace string) (int64, error) {
 	return count, nil
 }
 
-// DeleteRequestByID 根据ID删除请求记录
-func DeleteRequestByID(id uint) error {
-	result := gdb.Delete(&module.RateLimitRecord{}, id)
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete request record: %w", result.Error)
+// RefundRequestByID 把计入额度的请求记录标记为已退还，如果该请求消耗的是奖励额度则同时归还，
+// 记录保留下来用于用量历史
+func RefundRequestByID(id uint) error {
+	err := gdb.Transaction(func(tx *gorm.DB) error {
+		var record module.RateLimitRecord
+
+		result := tx.Model(&record).
+			Clauses(clause.Returning{}).
+			Where("id = ? AND status IN ?", id, monthlyCountedStatuses).
+			Update("status", module.RateLimitStatusRefunded)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 || record.CreditGrantID == nil {
+			return nil
+		}
+
+		return tx.Model(&module.CreditGrant{}).
+			Where("id = ? AND used > 0", *record.CreditGrantID).
+			Update("used", gorm.Expr("used - 1")).
+			Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund request record: %w", err)
 	}
 
 	return nil
@@ -81,6 +123,7 @@ func getNextResetTime(namespace string) (time.Time, error) {
 
 	result := gdb.Where("namespace = ? AND request_time >= ? AND request_time <= ?",
 		namespace, startOfDay, endOfDay).
+		Where("credit_grant_id IS NULL AND status = ?", module.RateLimitStatusCounted).
 		Order("request_time ASC").
 		First(&record)
 
@@ -99,3 +142,86 @@ func getNextResetTime(namespace string) (time.Time, error) {
 
 	return nextResetTime, nil
 }
+
+const rollingMonthDuration = 30 * 24 * time.Hour
+
+// monthlyCountedStatuses 计入月度额度的记录状态，只重置了每日额度的记录仍然计入月度额度
+var monthlyCountedStatuses = []string{
+	module.RateLimitStatusCounted,
+	module.RateLimitStatusDayVoided,
+}
+
+// monthlyWindow 返回当前月度统计窗口的起始时间，calendar模式为本月1日，rolling模式为30天前
+func monthlyWindow(now time.Time, mode string) time.Time {
+	if mode == config.MonthlyLimitModeRolling {
+		return now.Add(-rollingMonthDuration)
+	}
+
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+}
+
+// CountRequestsThisMonth 查询某个namespace在当前月度窗口内消耗额度的请求数量（不包括消耗奖励额度的请求）
+func CountRequestsThisMonth(namespace, mode string) (int64, error) {
+	now := time.Now()
+
+	var count int64
+
+	result := gdb.Model(&module.RateLimitRecord{}).
+		Where("namespace = ? AND request_time >= ? AND request_time <= ?",
+			namespace, monthlyWindow(now, mode).UnixMilli(), now.UnixMilli()).
+		Where("credit_grant_id IS NULL AND status IN ?", monthlyCountedStatuses).
+		Count(&count)
+
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to count requests this month: %w", result.Error)
+	}
+
+	return count, nil
+}
+
+// GetMonthlyUsageInfo 获取某个namespace在当前月度窗口内的使用情况信息
+func GetMonthlyUsageInfo(
+	namespace, mode string,
+) (usedThisMonth int64, nextResetTime time.Time, err error) {
+	usedThisMonth, err = CountRequestsThisMonth(namespace, mode)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	nextResetTime, err = getNextMonthlyResetTime(namespace, mode)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get next monthly reset time: %w", err)
+	}
+
+	return usedThisMonth, nextResetTime, nil
+}
+
+// getNextMonthlyResetTime calendar模式为下个月1日，rolling模式为窗口内最早请求的30天后
+func getNextMonthlyResetTime(namespace, mode string) (time.Time, error) {
+	now := time.Now()
+
+	if mode != config.MonthlyLimitModeRolling {
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location()), nil
+	}
+
+	var record module.RateLimitRecord
+
+	result := gdb.Where("namespace = ? AND request_time >= ? AND request_time <= ?",
+		namespace, monthlyWindow(now, mode).UnixMilli(), now.UnixMilli()).
+		Where("credit_grant_id IS NULL AND status IN ?", monthlyCountedStatuses).
+		Order("request_time ASC").
+		First(&record)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return now.Add(rollingMonthDuration), nil
+		}
+
+		return time.Time{}, fmt.Errorf(
+			"failed to get earliest request this month: %w",
+			result.Error,
+		)
+	}
+
+	return time.UnixMilli(record.RequestTime).Add(rollingMonthDuration), nil
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	retentionInterval = time.Hour
+	deleteBatchSize   = 10000
+	// ipRequestRetention 来源IP的记录只用于当天的限流
+	ipRequestRetention = 48 * time.Hour
+	// webhookDeliveryRetention 已结束的webhook投递保留一段时间便于排查
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+)
+
+// deleteInBatches 分批删除table中满足cond的行，避免一次删除过多的行长时间锁表
+func deleteInBatches(table, cond string, args ...any) (int64, error) {
+	var deleted int64
+
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE id IN (SELECT id FROM %s WHERE %s LIMIT %d)",
+		table, table, cond, deleteBatchSize,
+	)
+
+	for {
+		result := gdb.Exec(query, args...)
+		if result.Error != nil {
+			return deleted, result.Error
+		}
+
+		deleted += result.RowsAffected
+
+		if result.RowsAffected < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// DeleteRequestsBefore 分批删除before之前的请求记录，返回删除的数量
+func DeleteRequestsBefore(before time.Time) (int64, error) {
+	deleted, err := deleteInBatches("rate_limit_records", "request_time < ?", before.UnixMilli())
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete request records: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// DeleteIPRequestsBefore 分批删除before之前的来源IP请求记录，返回删除的数量
+func DeleteIPRequestsBefore(before time.Time) (int64, error) {
+	deleted, err := deleteInBatches("ip_rate_limit_records", "request_time < ?", before.UnixMilli())
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete ip request records: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// StartRetention 定期删除超过保留时间的请求记录、影子策略差异、审计事件和webhook投递，保留时间为0时永久保留
+func StartRetention(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(retentionInterval)
+		defer ticker.Stop()
+
+		for {
+			cleanUp(time.Now())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// usageRetention 请求记录的保留时间，保存的计划也可能开启月度限额，
+// 此时保留时间至少覆盖一个月度窗口
+func usageRetention() time.Duration {
+	if config.UsageRetention > 0 && EnforcedLimitPolicy().MonthlyRequestLimit > 0 {
+		return max(config.UsageRetention, config.MinUsageRetention)
+	}
+
+	return config.UsageRetention
+}
+
+func cleanUp(now time.Time) {
+	jobs := []struct {
+		name      string
+		retention time.Duration
+		run       func(before time.Time) (int64, error)
+	}{
+		{"request records", usageRetention(), DeleteRequestsBefore},
+		{"shadow decisions", usageRetention(), DeleteShadowDecisionsBefore},
+		{"ip request records", ipRequestRetention, DeleteIPRequestsBefore},
+		{"audit events", config.AuditRetention, DeleteAuditEventsBefore},
+		{"webhook deliveries", webhookDeliveryRetention, DeleteWebhookDeliveriesBefore},
+	}
+
+	for _, job := range jobs {
+		if job.retention <= 0 {
+			continue
+		}
+
+		deleted, err := job.run(now.Add(-job.retention))
+		if err != nil {
+			log.Errorf("Failed to clean up %s: %v", job.name, err)
+			continue
+		}
+
+		if deleted > 0 {
+			log.Infof("Deleted %d %s older than %s", deleted, job.name, job.retention)
+		}
+	}
+}
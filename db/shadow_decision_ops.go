@@ -0,0 +1,65 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IncrShadowDecision 累加namespace在某个时间所在日期的影子策略差异，wouldAllow表示影子策略会放行
+func IncrShadowDecision(t time.Time, namespace string, wouldAllow bool) error {
+	decision := module.ShadowDecision{Namespace: namespace, Day: t.Format(time.DateOnly)}
+	if wouldAllow {
+		decision.WouldAllow = 1
+	} else {
+		decision.WouldReject = 1
+	}
+
+	result := gdb.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "namespace"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"would_reject": gorm.Expr("shadow_decisions.would_reject + excluded.would_reject"),
+			"would_allow":  gorm.Expr("shadow_decisions.would_allow + excluded.would_allow"),
+			"updated_at":   time.Now(),
+		}),
+	}).Create(&decision)
+	if result.Error != nil {
+		return fmt.Errorf(
+			"failed to increase shadow decision of namespace '%s': %w",
+			namespace,
+			result.Error,
+		)
+	}
+
+	return nil
+}
+
+// SumShadowDecisions 汇总from所在日期以来每个namespace的影子策略差异，Day为空
+func SumShadowDecisions(from time.Time) ([]module.ShadowDecision, error) {
+	var decisions []module.ShadowDecision
+
+	result := gdb.Model(&module.ShadowDecision{}).
+		Select("namespace, SUM(would_reject) AS would_reject, SUM(would_allow) AS would_allow").
+		Where("day >= ?", from.Format(time.DateOnly)).
+		Group("namespace").
+		Order("namespace").
+		Find(&decisions)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to sum shadow decisions: %w", result.Error)
+	}
+
+	return decisions, nil
+}
+
+// DeleteShadowDecisionsBefore 删除before所在日期之前的影子策略差异，返回删除的数量
+func DeleteShadowDecisionsBefore(before time.Time) (int64, error) {
+	result := gdb.Where("day < ?", before.Format(time.DateOnly)).Delete(&module.ShadowDecision{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete shadow decisions: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
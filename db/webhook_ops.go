@@ -0,0 +1,180 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/module"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EnqueueWebhook 把事件写入发件箱，每个订阅了该事件的endpoint一行，
+// 相同dedupeKey的事件已经写入过时忽略，返回写入的行数
+func EnqueueWebhook(event, dedupeKey string, data any) (int64, error) {
+	return enqueueWebhook(gdb, event, dedupeKey, data)
+}
+
+// enqueueWebhook 在tx中写入发件箱，与触发事件的修改一起提交
+func enqueueWebhook(tx *gorm.DB, event, dedupeKey string, data any) (int64, error) {
+	now := time.Now()
+
+	var deliveries []module.WebhookDelivery
+
+	for _, endpoint := range config.WebhookEndpoints {
+		if !endpoint.Subscribed(event) {
+			continue
+		}
+
+		deliveries = append(deliveries, module.WebhookDelivery{
+			Event:         event,
+			DedupeKey:     dedupeKey,
+			Endpoint:      endpoint.URL,
+			Status:        module.WebhookStatusPending,
+			NextAttemptAt: now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return 0, nil
+	}
+
+	payload, err := sonic.Marshal(&module.WebhookEnvelope{
+		ID:        dedupeKey,
+		Event:     event,
+		CreatedAt: now.UnixMilli(),
+		Data:      data,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	for i := range deliveries {
+		deliveries[i].Payload = string(payload)
+	}
+
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries)
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook %s: %w", event, result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// enqueueNamespaceCreated 如果mapping是namespace下的第一个key，在tx中写入namespace.created事件，
+// 需要在写入mapping之前调用
+func enqueueNamespaceCreated(tx *gorm.DB, mapping *module.KeyMapping) error {
+	if len(config.WebhookEndpoints) == 0 {
+		return nil
+	}
+
+	var exists bool
+
+	result := tx.Raw(
+		"SELECT EXISTS (SELECT 1 FROM key_mappings WHERE namespace = ? AND key_hash <> ?)",
+		mapping.Namespace,
+		mapping.KeyHash,
+	).Scan(&exists)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if exists {
+		return nil
+	}
+
+	_, err := enqueueWebhook(
+		tx,
+		module.WebhookEventNamespaceCreated,
+		module.WebhookEventNamespaceCreated+":"+mapping.Namespace,
+		&module.NamespaceCreatedEvent{
+			Namespace: mapping.Namespace,
+			KeyPrefix: mapping.KeyPrefix,
+			Source:    mapping.Source,
+		},
+	)
+
+	return err
+}
+
+// ClaimDueWebhooks 领取最多limit个到期的投递并把下次尝试时间推迟lease，
+// 多个副本同时领取时不会拿到同一行，领取即计为一次尝试
+func ClaimDueWebhooks(limit int, lease time.Duration) ([]module.WebhookDelivery, error) {
+	now := time.Now()
+
+	var deliveries []module.WebhookDelivery
+
+	result := gdb.Raw(
+		`UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at ASC
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		now.Add(lease),
+		module.WebhookStatusPending,
+		now,
+		limit,
+	).Scan(&deliveries)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", result.Error)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered 标记投递成功
+func MarkWebhookDelivered(id uint) error {
+	result := gdb.Model(&module.WebhookDelivery{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"status":       module.WebhookStatusDelivered,
+			"delivered_at": time.Now(),
+			"last_error":   "",
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark webhook delivery %d delivered: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+// MarkWebhookFailed 记录投递失败，nextAttemptAt为零值时不再重试
+func MarkWebhookFailed(id uint, reason string, nextAttemptAt time.Time) error {
+	updates := map[string]any{
+		"last_error": reason,
+	}
+
+	if nextAttemptAt.IsZero() {
+		updates["status"] = module.WebhookStatusFailed
+	} else {
+		updates["next_attempt_at"] = nextAttemptAt
+	}
+
+	result := gdb.Model(&module.WebhookDelivery{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("failed to mark webhook delivery %d failed: %w", id, result.Error)
+	}
+
+	return nil
+}
+
+// DeleteWebhookDeliveriesBefore 分批删除before之前创建的已结束的投递，返回删除的数量
+func DeleteWebhookDeliveriesBefore(before time.Time) (int64, error) {
+	deleted, err := deleteInBatches(
+		"webhook_deliveries",
+		"status <> ? AND created_at < ?",
+		module.WebhookStatusPending,
+		before,
+	)
+	if err != nil {
+		return deleted, fmt.Errorf("failed to delete webhook deliveries: %w", err)
+	}
+
+	return deleted, nil
+}
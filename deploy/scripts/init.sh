@@ -51,6 +51,16 @@ if grep "<dsn-placeholder>" manifests/aiproxy-free-config.yaml >/dev/null 2>&1;
   sed -i "s|<dsn-placeholder>|${DSN}|g" manifests/aiproxy-free-config.yaml
 fi
 
+# Handle key hash secret, reuse the existing one so stored key mappings stay valid
+if grep "<key-hash-secret-placeholder>" manifests/aiproxy-free-config.yaml >/dev/null 2>&1; then
+  KEY_HASH_SECRET=$(kubectl get configmap -n aiproxy-system aiproxy-free-env -o jsonpath="{.data.KEY_HASH_SECRET}" 2>/dev/null) || true
+  if [[ -z "$KEY_HASH_SECRET" || "$KEY_HASH_SECRET" == "<key-hash-secret-placeholder>" ]]; then
+    KEY_HASH_SECRET=$(head -c 32 /dev/urandom | od -An -tx1 | tr -d ' \n')
+  fi
+
+  sed -i "s|<key-hash-secret-placeholder>|${KEY_HASH_SECRET}|g" manifests/aiproxy-free-config.yaml
+fi
+
 # Deploy application
 kubectl apply -f manifests/aiproxy-free-config.yaml -n aiproxy-system
 kubectl apply -f manifests/deploy.yaml -n aiproxy-system
@@ -18,19 +18,29 @@ import (
 	"github.com/labring/aiproxy-free/db"
 	"github.com/labring/aiproxy-free/server"
 	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/resolver"
+	"github.com/labring/aiproxy-free/server/webhook"
 	"github.com/labring/aiproxy-free/utils"
+	"github.com/labring/aiproxy-free/utils/metrics"
 	"github.com/labring/aiproxy-free/utils/pprof"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	listen    string
-	pprofPort int
+	listen      string
+	pprofPort   int
+	metricsPort int
 )
 
 func init() {
 	flag.StringVar(&listen, "listen", "0.0.0.0:3000", "http server listen")
 	flag.IntVar(&pprofPort, "pprof-port", 15000, "pport http server port")
+	flag.IntVar(
+		&metricsPort,
+		"metrics-port",
+		15001,
+		"prometheus metrics http server port, 0 disables it",
+	)
 }
 
 func initializePprof() {
@@ -42,6 +52,22 @@ func initializePprof() {
 	}()
 }
 
+func initializeMetrics() {
+	if metricsPort <= 0 {
+		return
+	}
+
+	metrics.RegisterCache("namespace", db.NamespaceCacheStats)
+	metrics.RegisterCache("rejected_key", middleware.RejectedKeyCacheStats)
+
+	go func() {
+		err := metrics.RunMetricsServer(metricsPort)
+		if err != nil {
+			log.Errorf("run metrics server error: %v", err)
+		}
+	}()
+}
+
 var loadedEnvFiles []string
 
 func loadEnv() {
@@ -86,12 +112,19 @@ func printLoadedEnvFiles() {
 
 func setupHTTPServer() (*http.Server, *gin.Engine) {
 	initializePprof()
+	initializeMetrics()
 
 	e := gin.New()
 
+	if err := e.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("invalid trusted proxies: %v", err)
+	}
+
 	e.Use(
 		gin.RecoveryWithWriter(log.StandardLogger().Writer()),
+		middleware.RequestIDMiddleware(),
 		middleware.NewLog(log.StandardLogger()),
+		middleware.MetricsMiddleware(),
 	)
 	server.SetRouter(e)
 
@@ -115,6 +148,7 @@ func listenAndServe(srv *http.Server) {
 }
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 
 	loadEnv()
@@ -125,15 +159,32 @@ func main() {
 
 	printLoadedEnvFiles()
 
+	if err := runCommand(flag.Args()); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func initDatabase() {
 	err := db.InitDatabase(config.DSN)
 	if err != nil {
 		log.Fatalf("init database failed: %v", err)
 	}
+}
+
+func serve() error {
+	initDatabase()
 	defer db.Close()
 
+	if err := resolver.InitFromConfig(); err != nil {
+		return fmt.Errorf("init namespace resolvers failed: %w", err)
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	db.StartRetention(ctx)
+	webhook.Start(ctx)
+
 	srv, _ := setupHTTPServer()
 	log.Infof("server started on http://%s", srv.Addr)
 
@@ -147,9 +198,10 @@ func main() {
 	log.Info("shutting down http server...")
 
 	if err := srv.Shutdown(shutdownSrvCtx); err != nil {
-		log.Error("server forced to shutdown: " + err.Error())
-		return
+		return fmt.Errorf("server forced to shutdown: %w", err)
 	}
 
 	log.Info("server shutdown successfully")
+
+	return nil
 }
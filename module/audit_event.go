@@ -0,0 +1,45 @@
+package module
+
+import "time"
+
+const (
+	AuditActionKeyMappingCreate = "key_mapping.create"
+	AuditActionKeyMappingUpdate = "key_mapping.update"
+	AuditActionKeyMappingDelete = "key_mapping.delete"
+	AuditActionKeyMappingImport = "key_mapping.import"
+	AuditActionBanCreate        = "ban.create"
+	AuditActionBanDelete        = "ban.delete"
+	AuditActionGrantCreate      = "credit_grant.create"
+	AuditActionGrantDelete      = "credit_grant.delete"
+	AuditActionQuotaAdjust      = "quota.adjust"
+	AuditActionPlanUpdate       = "plan.update"
+	AuditActionPlanDelete       = "plan.delete"
+	AuditActionAdminLogin       = "admin.login"
+	AuditActionAdminLoginFailed = "admin.login_failed"
+
+	AuditTargetKey         = "key"
+	AuditTargetBan         = "ban"
+	AuditTargetCreditGrant = "credit_grant"
+	AuditTargetNamespace   = "namespace"
+	AuditTargetIP          = "ip"
+	AuditTargetPlan        = "plan"
+)
+
+// AuditEvent 只追加的审计事件，key类型的目标保存为key的哈希，
+// Before和After为修改前后对象的JSON，创建时Before为空，删除时After为空
+type AuditEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Action     string    `gorm:"size:64;not null;index" json:"action"`
+	TargetType string    `gorm:"size:32;not null;index:idx_audit_target" json:"target_type"`
+	Target     string    `gorm:"size:255;not null;index:idx_audit_target" json:"target"`
+	Actor      string    `gorm:"size:255;not null;index" json:"actor"`
+	Before     string    `gorm:"type:text" json:"before,omitempty"`
+	After      string    `gorm:"type:text" json:"after,omitempty"`
+	RequestID  string    `gorm:"size:64;index" json:"request_id,omitempty"`
+	CreatedAt  time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
@@ -0,0 +1,30 @@
+package module
+
+import "time"
+
+const (
+	BanTargetKey       = "key"
+	BanTargetNamespace = "namespace"
+	BanTargetIP        = "ip"
+)
+
+// Ban 封禁记录，key类型的目标保存为key的哈希，ip类型的目标可以是单个IP或者CIDR
+type Ban struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	TargetType string     `gorm:"size:16;not null;index:idx_ban_target" json:"target_type"`
+	Target     string     `gorm:"size:255;not null;index:idx_ban_target" json:"target"`
+	Reason     string     `gorm:"size:255" json:"reason"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at"` // 为空表示永久封禁
+	CreatedBy  string     `gorm:"size:255" json:"created_by"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (Ban) TableName() string {
+	return "bans"
+}
+
+// Active 是否仍然生效
+func (b *Ban) Active(now time.Time) bool {
+	return b.ExpiresAt == nil || now.Before(*b.ExpiresAt)
+}
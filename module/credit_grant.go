@@ -0,0 +1,31 @@
+package module
+
+import "time"
+
+// CreditGrant 奖励额度，在每日额度用完之后按过期时间先后消耗
+type CreditGrant struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Namespace string    `gorm:"size:255;not null;index" json:"namespace"`
+	Amount    int64     `gorm:"not null" json:"amount"`         // 奖励的请求次数
+	Used      int64     `gorm:"not null;default:0" json:"used"` // 已经消耗的请求次数
+	Reason    string    `gorm:"size:255" json:"reason"`
+	StartsAt  time.Time `gorm:"not null" json:"starts_at"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedBy string    `gorm:"size:255" json:"created_by"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// TableName 指定表名
+func (CreditGrant) TableName() string {
+	return "credit_grants"
+}
+
+// Remaining 剩余可用次数
+func (g *CreditGrant) Remaining() int64 {
+	return max(g.Amount-g.Used, 0)
+}
+
+// Active 是否在有效期内
+func (g *CreditGrant) Active(now time.Time) bool {
+	return !now.Before(g.StartsAt) && now.Before(g.ExpiresAt)
+}
@@ -0,0 +1,17 @@
+package module
+
+import "time"
+
+// GlobalUsage 所有namespace共享的全局用量计数，用于控制上游总预算
+type GlobalUsage struct {
+	Period    string     `gorm:"primaryKey;size:32"` // 统计周期，如 day:2006-01-02 或 month:2006-01
+	Requests  int64      `gorm:"not null;default:0"` // 周期内消耗额度的请求数
+	Tokens    int64      `gorm:"not null;default:0"` // 周期内上游返回的token总数
+	AlertedAt *time.Time // 周期内首次触发告警的时间
+	UpdatedAt time.Time  `gorm:"autoUpdateTime"`
+}
+
+// TableName 指定表名
+func (GlobalUsage) TableName() string {
+	return "global_usages"
+}
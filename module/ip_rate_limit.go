@@ -0,0 +1,13 @@
+package module
+
+// IPRateLimitRecord 按来源IP的限流记录表，无论key是否有效都会记录
+type IPRateLimitRecord struct {
+	ID          uint   `gorm:"primaryKey"`
+	IP          string `gorm:"size:64;not null;index:idx_ip_timestamp"` // IPv4地址或聚合后的IPv6前缀
+	RequestTime int64  `gorm:"not null;index:idx_ip_timestamp"`         // 毫秒时间戳
+}
+
+// TableName 指定表名
+func (IPRateLimitRecord) TableName() string {
+	return "ip_rate_limit_records"
+}
@@ -2,12 +2,25 @@ package module
 
 import "time"
 
+const (
+	// KeyMappingSourceUpstream 通过上游校验自动创建的映射，其他resolver创建的映射以resolver名称作为来源
+	KeyMappingSourceUpstream = "upstream"
+	// KeyMappingSourceLocal 由本服务签发的key，不需要上游校验
+	KeyMappingSourceLocal = "local"
+)
+
 // KeyMapping key与namespace的映射表
 type KeyMapping struct {
-	Key       string    `gorm:"primaryKey;size:255"`     // key作为主键
-	Namespace string    `gorm:"size:255;not null;index"` // namespace，建立索引用于反向查询
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+	KeyHash   string    `gorm:"primaryKey;size:64" json:"key_hash"`                    // key的HMAC-SHA256，数据库中不保存明文key
+	KeyPrefix string    `gorm:"size:32;index" json:"key_prefix"`                       // key的前缀，只用于展示和日志
+	Namespace string    `gorm:"size:255;not null;index" json:"namespace"`              // namespace，建立索引用于反向查询
+	Source    string    `gorm:"size:32;not null;default:upstream;index" json:"source"` // 映射来源
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	// LastValidatedAt 最近一次向上游确认key仍然有效的时间
+	LastValidatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"last_validated_at"`
+	// Pinned 管理员手动指定了namespace，重新校验时只确认key仍然有效，不再按resolver的结果修改namespace
+	Pinned bool `gorm:"not null;default:false" json:"pinned"`
 }
 
 // TableName 指定表名
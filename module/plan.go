@@ -0,0 +1,21 @@
+package module
+
+import "time"
+
+// PlanDefault 默认计划的ID，所有namespace都使用这个计划
+const PlanDefault = "free"
+
+// Plan 通过管理接口保存的计划，存在时代替环境变量中配置的限额
+type Plan struct {
+	ID                  string    `gorm:"primaryKey;size:64" json:"id"`
+	DailyRequestLimit   int64     `gorm:"not null" json:"daily_request_limit"`
+	MonthlyRequestLimit int64     `gorm:"not null" json:"monthly_request_limit"` // 为0表示不限制
+	MonthlyLimitMode    string    `gorm:"size:16;not null" json:"monthly_limit_mode"`
+	UpdatedBy           string    `gorm:"size:255" json:"updated_by"`
+	UpdatedAt           time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (Plan) TableName() string {
+	return "plans"
+}
@@ -0,0 +1,33 @@
+package module
+
+import "time"
+
+const (
+	QuotaAdjustmentReset    = "reset"
+	QuotaAdjustmentAdd      = "add"
+	QuotaAdjustmentSubtract = "subtract"
+
+	// QuotaWindowDay 当天的每日额度窗口
+	QuotaWindowDay = "day"
+	// QuotaWindowMonth 当前的月度额度窗口
+	QuotaWindowMonth = "month"
+)
+
+// QuotaAdjustment 管理员手动调整额度的审计记录
+type QuotaAdjustment struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	Namespace string `gorm:"size:255;not null;index" json:"namespace"`
+	Action    string `gorm:"size:16;not null" json:"action"`
+	Window    string `gorm:"size:16;not null" json:"window"`
+	Amount    int64  `gorm:"not null" json:"amount"`   // 请求调整的次数，reset时为0
+	Affected  int64  `gorm:"not null" json:"affected"` // 实际新增或作废的记录数
+	Reason    string `gorm:"size:255" json:"reason"`
+	CreatedBy string `gorm:"size:255" json:"created_by"`
+	// CreatedAt 同时用于按时间倒序查询
+	CreatedAt time.Time `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (QuotaAdjustment) TableName() string {
+	return "quota_adjustments"
+}
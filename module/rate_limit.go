@@ -1,11 +1,28 @@
 // Package module defines data structures for the aiproxy application.
 package module
 
+const (
+	// RateLimitStatusCounted 计入额度的请求
+	RateLimitStatusCounted = "counted"
+	// RateLimitStatusRejected 因为额度用完被拒绝(429)的请求，只用于统计
+	RateLimitStatusRejected = "rejected"
+	// RateLimitStatusVoided 被管理员重置或扣减月度额度的请求，不再计入每日和月度额度
+	RateLimitStatusVoided = "voided"
+	// RateLimitStatusDayVoided 被管理员重置或扣减每日额度的请求，只从每日额度中扣除，仍然计入月度额度
+	RateLimitStatusDayVoided = "day_voided"
+	// RateLimitStatusRefunded 根据退款策略退还的请求，不再计入额度
+	RateLimitStatusRefunded = "refunded"
+)
+
 // RateLimitRecord 限流记录表
 type RateLimitRecord struct {
-	ID          uint   `gorm:"primaryKey"`
-	Namespace   string `gorm:"size:255;not null;index:idx_namespace_timestamp"`
-	RequestTime int64  `gorm:"not null;index:idx_namespace_timestamp"` // 毫秒时间戳
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Namespace   string `gorm:"size:255;not null;index:idx_namespace_timestamp" json:"namespace"`
+	RequestTime int64  `gorm:"not null;index:idx_namespace_timestamp;index:idx_request_time" json:"request_time"` // 毫秒时间戳
+	Status      string `gorm:"size:16;not null;default:counted" json:"status"`
+	Model       string `gorm:"size:128" json:"model,omitempty"` // 请求体中的model字段
+	// CreditGrantID 不为空表示该请求消耗的是奖励额度而不是每日额度
+	CreditGrantID *uint `gorm:"index" json:"credit_grant_id,omitempty"`
 }
 
 // TableName 指定表名
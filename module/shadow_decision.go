@@ -0,0 +1,17 @@
+package module
+
+import "time"
+
+// ShadowDecision 每个namespace每天影子策略与实际策略判断不一致的请求数，多副本共同累加
+type ShadowDecision struct {
+	Namespace   string    `gorm:"primaryKey;size:255" json:"namespace"`
+	Day         string    `gorm:"primaryKey;size:10" json:"day"`          // 统计日期，格式为 2006-01-02
+	WouldReject int64     `gorm:"not null;default:0" json:"would_reject"` // 实际放行但影子策略会拒绝的请求数
+	WouldAllow  int64     `gorm:"not null;default:0" json:"would_allow"`  // 实际拒绝但影子策略会放行的请求数
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (ShadowDecision) TableName() string {
+	return "shadow_decisions"
+}
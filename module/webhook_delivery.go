@@ -0,0 +1,73 @@
+package module
+
+import "time"
+
+const (
+	// WebhookEventQuotaThreshold namespace的每日用量达到阈值
+	WebhookEventQuotaThreshold = "quota.threshold"
+	// WebhookEventNamespaceCreated 第一次有key映射到某个namespace
+	WebhookEventNamespaceCreated = "namespace.created"
+	// WebhookEventGlobalBudgetExhausted 全局用量在某个周期内第一次达到上限
+	WebhookEventGlobalBudgetExhausted = "global_budget.exhausted"
+
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusFailed    = "failed"
+)
+
+// WebhookDelivery webhook发件箱，每个事件对每个订阅的endpoint一行，
+// DedupeKey和Endpoint唯一，保证同一个事件对同一个endpoint最多发送一次
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Event         string     `gorm:"size:64;not null" json:"event"`
+	DedupeKey     string     `gorm:"size:512;not null;uniqueIndex:idx_webhook_dedupe" json:"dedupe_key"`
+	Endpoint      string     `gorm:"size:1024;not null;uniqueIndex:idx_webhook_dedupe" json:"endpoint"`
+	Payload       string     `gorm:"type:text;not null" json:"payload"` // 发送的请求体，签名基于它计算
+	Status        string     `gorm:"size:16;not null;index:idx_webhook_due" json:"status"`
+	Attempts      int64      `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_webhook_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime;index" json:"created_at"`
+}
+
+// TableName 指定表名
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// WebhookEnvelope webhook请求体，ID即去重key，接收方可以用它去重
+type WebhookEnvelope struct {
+	ID        string `json:"id"`
+	Event     string `json:"event"`
+	CreatedAt int64  `json:"created_at"` // 毫秒时间戳
+	Data      any    `json:"data"`
+}
+
+// QuotaThresholdEvent quota.threshold事件的数据
+type QuotaThresholdEvent struct {
+	Namespace string `json:"namespace"`
+	Window    string `json:"window"`    // 目前只有day
+	Period    string `json:"period"`    // 窗口所在的日期，格式为2006-01-02
+	Threshold int64  `json:"threshold"` // 百分比
+	Used      int64  `json:"used"`
+	Limit     int64  `json:"limit"`
+}
+
+// NamespaceCreatedEvent namespace.created事件的数据
+type NamespaceCreatedEvent struct {
+	Namespace string `json:"namespace"`
+	KeyPrefix string `json:"key_prefix"`
+	Source    string `json:"source"`
+}
+
+// GlobalBudgetExhaustedEvent global_budget.exhausted事件的数据
+type GlobalBudgetExhaustedEvent struct {
+	Period                    string `json:"period"` // 统计周期，如 day:2006-01-02 或 month:2006-01
+	Requests                  int64  `json:"requests"`
+	Tokens                    int64  `json:"tokens"`
+	GlobalDailyRequestLimit   int64  `json:"global_daily_request_limit"`
+	GlobalMonthlyRequestLimit int64  `json:"global_monthly_request_limit"`
+	GlobalDailyTokenLimit     int64  `json:"global_daily_token_limit"`
+	GlobalMonthlyTokenLimit   int64  `json:"global_monthly_token_limit"`
+}
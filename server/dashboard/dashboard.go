@@ -0,0 +1,36 @@
+// Package dashboard serves the admin web dashboard embedded into the binary.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BasePath is where the dashboard is mounted
+const BasePath = "/admin/ui"
+
+//go:embed static
+var staticFS embed.FS
+
+// Handler serves the dashboard files, the page itself is public and logs in
+// against the admin API which does the actual authorization
+func Handler() gin.HandlerFunc {
+	sub, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	fileServer := http.StripPrefix(BasePath, http.FileServer(http.FS(sub)))
+
+	return func(c *gin.Context) {
+		c.Header("X-Frame-Options", "DENY")
+		c.Header(
+			"Content-Security-Policy",
+			"default-src 'self'; frame-ancestors 'none'",
+		)
+		fileServer.ServeHTTP(c.Writer, c.Request)
+	}
+}
@@ -0,0 +1,334 @@
+'use strict';
+
+const $ = (sel) => document.querySelector(sel);
+const PAGE_SIZE = 50;
+const HOUR = 3600 * 1000;
+
+async function api(method, path, body) {
+  const opts = { method, headers: { 'X-Admin-Session': '1' }, credentials: 'same-origin' };
+  if (body !== undefined) {
+    opts.headers['Content-Type'] = 'application/json';
+    opts.body = JSON.stringify(body);
+  }
+  const resp = await fetch('/admin' + path, opts);
+  if (resp.status === 401) {
+    showLogin();
+    throw new Error('Session expired');
+  }
+  if (resp.status === 204) {
+    return null;
+  }
+  const data = await resp.json();
+  if (!resp.ok) {
+    throw new Error((data.error && data.error.message) || resp.statusText);
+  }
+  return data;
+}
+
+function showError(err) {
+  $('#app-error').textContent = err ? err.message : '';
+}
+
+function cell(text, tag = 'td') {
+  const el = document.createElement(tag);
+  el.textContent = text === undefined || text === null ? '' : String(text);
+  return el;
+}
+
+function button(label, onClick, danger) {
+  const td = document.createElement('td');
+  const b = document.createElement('button');
+  b.textContent = label;
+  if (danger) {
+    b.className = 'danger';
+  }
+  b.addEventListener('click', () => onClick().catch(showError));
+  td.appendChild(b);
+  return td;
+}
+
+function fillTable(sel, rows, render) {
+  const body = $(sel + ' tbody');
+  body.replaceChildren();
+  for (const row of rows) {
+    const tr = document.createElement('tr');
+    for (const td of render(row)) {
+      tr.appendChild(td);
+    }
+    body.appendChild(tr);
+  }
+}
+
+function formatTime(value) {
+  return value ? new Date(value).toLocaleString() : 'never';
+}
+
+// overview
+
+async function loadOverview() {
+  const now = Date.now();
+  const [minute, hour, day, top, series] = await Promise.all([
+    api('GET', `/analytics/summary?from=${now - 60 * 1000}&to=${now}`),
+    api('GET', `/analytics/summary?from=${now - HOUR}&to=${now}`),
+    api('GET', `/analytics/summary?from=${now - 24 * HOUR}&to=${now}`),
+    api('GET', `/analytics/top-namespaces?from=${now - 24 * HOUR}&to=${now}&limit=20`),
+    api('GET', `/analytics/series?granularity=hour&from=${now - 24 * HOUR}&to=${now}`),
+  ]);
+
+  $('#rate-minute').textContent = minute.requests;
+  $('#rate-hour').textContent = hour.requests;
+  $('#rejected-day').textContent = day.rejected;
+  $('#namespaces-day').textContent = day.namespaces;
+
+  fillTable('#top', top.namespaces || [], (n) => [cell(n.namespace), cell(n.requests), cell(n.rejected)]);
+
+  const bars = $('#series');
+  bars.replaceChildren();
+  const points = series.series || [];
+  const peak = Math.max(1, ...points.map((p) => p.requests));
+  for (const p of points) {
+    const bar = document.createElement('div');
+    bar.style.height = `${(p.requests / peak) * 100}%`;
+    bar.title = `${formatTime(p.time)}: ${p.requests} requests, ${p.rejected} rejected`;
+    bars.appendChild(bar);
+  }
+}
+
+// key mappings
+
+let mappingPage = 1;
+
+async function loadMappings() {
+  const form = new FormData($('#mapping-search'));
+  const params = new URLSearchParams({ page: mappingPage, page_size: PAGE_SIZE });
+  for (const name of ['namespace', 'key_prefix']) {
+    if (form.get(name)) {
+      params.set(name, form.get(name));
+    }
+  }
+
+  const data = await api('GET', '/mappings?' + params);
+  const pages = Math.max(1, Math.ceil(data.total / PAGE_SIZE));
+  $('#mappings-page').textContent = `page ${data.page} of ${pages} (${data.total} keys)`;
+  $('#mappings-prev').disabled = data.page <= 1;
+  $('#mappings-next').disabled = data.page >= pages;
+
+  fillTable('#mappings', data.mappings || [], (m) => [
+    cell(m.key_prefix),
+    cell(m.namespace),
+    cell(m.pinned ? m.source + ' (pinned)' : m.source),
+    cell(formatTime(m.last_validated_at)),
+    button('Move', async () => {
+      const namespace = prompt(`New namespace for ${m.key_prefix}`, m.namespace);
+      if (namespace && namespace !== m.namespace) {
+        await api('PUT', '/mappings/' + m.key_hash, { namespace });
+        await loadMappings();
+      }
+    }),
+    button('Delete', async () => {
+      if (confirm(`Delete mapping of ${m.key_prefix}?`)) {
+        await api('DELETE', '/mappings/' + m.key_hash);
+        await loadMappings();
+      }
+    }, true),
+  ]);
+}
+
+// bans
+
+async function loadBans() {
+  const data = await api('GET', '/bans?active=true');
+  fillTable('#bans', data.bans || [], (b) => [
+    cell(b.target_type),
+    cell(b.target_type === 'key' ? b.target.slice(0, 12) + '...' : b.target),
+    cell(b.reason),
+    cell(b.expires_at ? formatTime(b.expires_at) : 'permanent'),
+    cell(b.created_by),
+    button('Lift', async () => {
+      await api('DELETE', '/bans/' + b.id);
+      await loadBans();
+    }, true),
+  ]);
+}
+
+async function createBan(event) {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  const body = {
+    target_type: form.get('target_type'),
+    target: form.get('target'),
+    reason: form.get('reason'),
+  };
+  if (form.get('expires_at')) {
+    body.expires_at = new Date(form.get('expires_at')).getTime();
+  }
+  await api('POST', '/bans', body);
+  event.target.reset();
+  await loadBans();
+}
+
+// plan, limits and grants
+
+async function loadLimits() {
+  const [plan, limits, grants] = await Promise.all([
+    api('GET', '/plan'),
+    api('GET', '/limits'),
+    api('GET', '/grants?active=true'),
+  ]);
+
+  const form = $('#plan-form');
+  for (const name of ['daily_request_limit', 'monthly_request_limit', 'monthly_limit_mode']) {
+    form.elements[name].value = plan.policy[name];
+  }
+  if (plan.plan) {
+    const by = plan.plan.updated_by || 'unknown';
+    $('#plan-source').textContent =
+      `Saved by ${by} on ${formatTime(plan.plan.updated_at)}, applies to every namespace.`;
+  } else {
+    $('#plan-source').textContent =
+      'Using the limits configured through the environment, a saved plan overrides them.';
+  }
+  $('#plan-reset').disabled = !plan.plan;
+
+  delete limits.enforced_policy;
+  $('#limits').textContent = JSON.stringify(limits, null, 2);
+
+  fillTable('#grants', grants.grants || [], (g) => [
+    cell(g.namespace),
+    cell(`${g.used} / ${g.amount}`),
+    cell(g.reason),
+    cell(formatTime(g.expires_at)),
+    cell(g.created_by),
+    button('Revoke', async () => {
+      await api('DELETE', '/grants/' + g.id);
+      await loadLimits();
+    }, true),
+  ]);
+}
+
+async function savePlan(event) {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  await api('PUT', '/plan', {
+    daily_request_limit: Number(form.get('daily_request_limit')),
+    monthly_request_limit: Number(form.get('monthly_request_limit')),
+    monthly_limit_mode: form.get('monthly_limit_mode'),
+  });
+  await loadLimits();
+}
+
+async function resetPlan() {
+  if (confirm('Drop the saved plan and use the limits configured through the environment?')) {
+    await api('DELETE', '/plan');
+    await loadLimits();
+  }
+}
+
+async function createGrant(event) {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  await api('POST', '/grants', {
+    namespace: form.get('namespace'),
+    amount: Number(form.get('amount')),
+    reason: form.get('reason'),
+    expires_at: new Date(form.get('expires_at')).getTime(),
+  });
+  event.target.reset();
+  await loadLimits();
+}
+
+// navigation and session
+
+const loaders = {
+  overview: loadOverview,
+  mappings: loadMappings,
+  bans: loadBans,
+  limits: loadLimits,
+};
+
+let currentTab = 'overview';
+let refreshTimer;
+
+function showTab(tab) {
+  currentTab = tab;
+  for (const b of document.querySelectorAll('header nav button')) {
+    b.classList.toggle('active', b.dataset.tab === tab);
+  }
+  for (const el of document.querySelectorAll('.tab')) {
+    el.hidden = el.id !== 'tab-' + tab;
+  }
+  showError(null);
+  loaders[tab]().catch(showError);
+}
+
+function showLogin() {
+  clearInterval(refreshTimer);
+  $('#app').hidden = true;
+  $('#login').hidden = false;
+}
+
+function showApp(actor) {
+  $('#login').hidden = true;
+  $('#app').hidden = false;
+  $('#actor').textContent = actor;
+  showTab(currentTab);
+  clearInterval(refreshTimer);
+  refreshTimer = setInterval(() => {
+    if (currentTab === 'overview') {
+      loadOverview().catch(showError);
+    }
+  }, 10000);
+}
+
+async function login(event) {
+  event.preventDefault();
+  const form = new FormData(event.target);
+  const resp = await fetch('/admin/session', {
+    method: 'POST',
+    headers: { 'Content-Type': 'application/json' },
+    credentials: 'same-origin',
+    body: JSON.stringify({ token: form.get('token'), actor: form.get('actor') }),
+  });
+  const data = await resp.json();
+  if (!resp.ok) {
+    $('#login-error').textContent = (data.error && data.error.message) || resp.statusText;
+    return;
+  }
+  event.target.reset();
+  $('#login-error').textContent = '';
+  showApp(data.actor);
+}
+
+async function logout() {
+  await fetch('/admin/session', { method: 'DELETE', credentials: 'same-origin' });
+  showLogin();
+}
+
+document.addEventListener('DOMContentLoaded', () => {
+  $('#login-form').addEventListener('submit', login);
+  $('#logout').addEventListener('click', logout);
+  for (const b of document.querySelectorAll('header nav button')) {
+    b.addEventListener('click', () => showTab(b.dataset.tab));
+  }
+  $('#mapping-search').addEventListener('submit', (event) => {
+    event.preventDefault();
+    mappingPage = 1;
+    loadMappings().catch(showError);
+  });
+  $('#mappings-prev').addEventListener('click', () => {
+    mappingPage--;
+    loadMappings().catch(showError);
+  });
+  $('#mappings-next').addEventListener('click', () => {
+    mappingPage++;
+    loadMappings().catch(showError);
+  });
+  $('#ban-form').addEventListener('submit', (event) => createBan(event).catch(showError));
+  $('#plan-form').addEventListener('submit', (event) => savePlan(event).catch(showError));
+  $('#plan-reset').addEventListener('click', () => resetPlan().catch(showError));
+  $('#grant-form').addEventListener('submit', (event) => createGrant(event).catch(showError));
+
+  api('GET', '/whoami')
+    .then((data) => showApp(data.actor))
+    .catch(() => showLogin());
+});
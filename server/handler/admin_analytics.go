@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultTopNamespaces = 20
+	maxTopNamespaces     = 200
+
+	// 查询范围上限，避免一次扫描过多的请求记录
+	maxSummaryRange      = 92 * 24 * time.Hour
+	maxHourlySeriesRange = 7 * 24 * time.Hour
+	maxDailySeriesRange  = 366 * 24 * time.Hour
+)
+
+// parseTimeRange 解析from和to参数（毫秒时间戳），to默认为当前时间，from默认为to之前defaultRange，
+// 范围超过maxRange时返回错误提示
+func parseTimeRange(
+	c *gin.Context,
+	defaultRange, maxRange time.Duration,
+) (from, to time.Time, message string) {
+	to = time.Now()
+
+	if v := c.Query("to"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, "Invalid to"
+		}
+
+		to = time.UnixMilli(ms)
+	}
+
+	from = to.Add(-defaultRange)
+
+	if v := c.Query("from"); v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, time.Time{}, "Invalid from"
+		}
+
+		from = time.UnixMilli(ms)
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, "from must be before to"
+	}
+
+	if to.Sub(from) > maxRange {
+		return time.Time{}, time.Time{}, fmt.Sprintf("Time range must not exceed %s", maxRange)
+	}
+
+	return from, to, ""
+}
+
+func TopNamespacesHandler(c *gin.Context) {
+	from, to, message := parseTimeRange(c, 24*time.Hour, maxSummaryRange)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(message))
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit < 1 {
+		limit = defaultTopNamespaces
+	}
+
+	orderBy := c.DefaultQuery("order_by", "requests")
+	if orderBy != "requests" && orderBy != "rejected" {
+		c.JSON(
+			http.StatusBadRequest,
+			module.NewInvalidRequestError("order_by must be requests or rejected"),
+		)
+
+		return
+	}
+
+	counts, err := db.TopNamespaces(from, to, min(limit, maxTopNamespaces), orderBy == "rejected")
+	if err != nil {
+		log.Errorf("Failed to query top namespaces: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from.UnixMilli(),
+		"to":         to.UnixMilli(),
+		"namespaces": counts,
+	})
+}
+
+func UsageSeriesHandler(c *gin.Context) {
+	var (
+		defaultRange time.Duration
+		maxRange     time.Duration
+	)
+
+	granularity := c.DefaultQuery("granularity", "hour")
+	switch granularity {
+	case "hour":
+		defaultRange, maxRange = 24*time.Hour, maxHourlySeriesRange
+	case "day":
+		defaultRange, maxRange = 30*24*time.Hour, maxDailySeriesRange
+	default:
+		c.JSON(
+			http.StatusBadRequest,
+			module.NewInvalidRequestError("granularity must be hour or day"),
+		)
+
+		return
+	}
+
+	from, to, message := parseTimeRange(c, defaultRange, maxRange)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(message))
+		return
+	}
+
+	namespace := c.Query("namespace")
+
+	var (
+		buckets []db.UsageBucket
+		err     error
+	)
+
+	if granularity == "day" {
+		buckets, err = db.DailyUsageSeries(namespace, from, to)
+	} else {
+		buckets, err = db.UsageSeries(namespace, from, to, time.Hour)
+	}
+
+	if err != nil {
+		log.Errorf("Failed to query usage series: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"namespace":   namespace,
+		"granularity": granularity,
+		"from":        from.UnixMilli(),
+		"to":          to.UnixMilli(),
+		"series":      buckets,
+	})
+}
+
+func UsageSummaryHandler(c *gin.Context) {
+	from, to, message := parseTimeRange(c, 24*time.Hour, maxSummaryRange)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(message))
+		return
+	}
+
+	summary, err := db.GetUsageSummary(from, to)
+	if err != nil {
+		log.Errorf("Failed to query usage summary: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":       from.UnixMilli(),
+		"to":         to.UnixMilli(),
+		"requests":   summary.Requests,
+		"rejected":   summary.Rejected,
+		"namespaces": summary.Namespaces,
+	})
+}
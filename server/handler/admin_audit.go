@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListAuditEventsHandler queries the audit log, from and to are millisecond
+// timestamps
+func ListAuditEventsHandler(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	filter := db.AuditEventFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		Target:     c.Query("target"),
+		Actor:      c.Query("actor"),
+		RequestID:  c.Query("request_id"),
+	}
+
+	for name, t := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		v := c.Query(name)
+		if v == "" {
+			continue
+		}
+
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("Invalid "+name))
+			return
+		}
+
+		*t = time.UnixMilli(ms)
+	}
+
+	events, total, err := db.ListAuditEvents(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("Failed to list audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListBansHandler(c *gin.Context) {
+	activeOnly, _ := strconv.ParseBool(c.Query("active"))
+
+	bans, err := db.ListBans(c.Query("target_type"), activeOnly)
+	if err != nil {
+		log.Errorf("Failed to list bans: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bans": bans,
+	})
+}
+
+func CreateBanHandler(c *gin.Context) {
+	var req module.CreateBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	target, message := normalizeBanTarget(req)
+	if message != "" {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(message))
+		return
+	}
+
+	ban := &dbmodule.Ban{
+		TargetType: req.TargetType,
+		Target:     target,
+		Reason:     req.Reason,
+		CreatedBy:  c.GetString(middleware.AdminActorKey),
+	}
+
+	if req.ExpiresAt > 0 {
+		expiresAt := time.UnixMilli(req.ExpiresAt)
+		if !expiresAt.After(time.Now()) {
+			c.JSON(
+				http.StatusBadRequest,
+				module.NewInvalidRequestError("expires_at must be in the future"),
+			)
+
+			return
+		}
+
+		ban.ExpiresAt = &expiresAt
+	}
+
+	if err := db.CreateBan(middleware.AuditFromContext(c), ban); err != nil {
+		log.Errorf("Failed to create ban: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	middleware.ReloadBans()
+	c.JSON(http.StatusCreated, ban)
+}
+
+// normalizeBanTarget 把key转换为哈希，校验IP和CIDR，返回错误提示
+func normalizeBanTarget(req module.CreateBanRequest) (string, string) {
+	switch req.TargetType {
+	case dbmodule.BanTargetKey:
+		if req.Hashed {
+			return strings.ToLower(req.Target), ""
+		}
+
+		return db.HashKey(req.Target), ""
+	case dbmodule.BanTargetIP:
+		if strings.Contains(req.Target, "/") {
+			prefix, err := netip.ParsePrefix(req.Target)
+			if err != nil {
+				return "", "Invalid CIDR"
+			}
+
+			return prefix.Masked().String(), ""
+		}
+
+		addr, err := netip.ParseAddr(req.Target)
+		if err != nil {
+			return "", "Invalid IP address"
+		}
+
+		return addr.Unmap().String(), ""
+	default:
+		return req.Target, ""
+	}
+}
+
+func DeleteBanHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("Invalid ban id"))
+		return
+	}
+
+	if err := db.DeleteBan(middleware.AuditFromContext(c), uint(id)); err != nil {
+		if errors.Is(err, db.ErrBanNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to delete ban: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	middleware.ReloadBans()
+	c.Status(http.StatusNoContent)
+}
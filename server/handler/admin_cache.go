@@ -0,0 +1,18 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/middleware"
+)
+
+// CacheStatsHandler returns the hit and miss counts of this replica's key to
+// namespace cache and rejected key cache
+func CacheStatsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"namespace_cache":    db.NamespaceCacheStats(),
+		"rejected_key_cache": middleware.RejectedKeyCacheStats(),
+	})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+func ListCreditGrantsHandler(c *gin.Context) {
+	namespace := c.Query("namespace")
+	activeOnly, _ := strconv.ParseBool(c.Query("active"))
+
+	grants, err := db.ListCreditGrants(namespace, activeOnly)
+	if err != nil {
+		log.Errorf("Failed to list credit grants: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"grants": grants,
+	})
+}
+
+func CreateCreditGrantHandler(c *gin.Context) {
+	var req module.CreateCreditGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt > 0 {
+		startsAt = time.UnixMilli(req.StartsAt)
+	}
+
+	expiresAt := time.UnixMilli(req.ExpiresAt)
+	if !expiresAt.After(startsAt) {
+		c.JSON(
+			http.StatusBadRequest,
+			module.NewInvalidRequestError("expires_at must be after starts_at"),
+		)
+
+		return
+	}
+
+	grant := &dbmodule.CreditGrant{
+		Namespace: req.Namespace,
+		Amount:    req.Amount,
+		Reason:    req.Reason,
+		StartsAt:  startsAt,
+		ExpiresAt: expiresAt,
+		CreatedBy: c.GetString(middleware.AdminActorKey),
+	}
+
+	if err := db.CreateCreditGrant(middleware.AuditFromContext(c), grant); err != nil {
+		log.Errorf("Failed to create credit grant: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusCreated, grant)
+}
+
+func DeleteCreditGrantHandler(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("Invalid grant id"))
+		return
+	}
+
+	if err := db.DeleteCreditGrant(middleware.AuditFromContext(c), uint(id)); err != nil {
+		if errors.Is(err, db.ErrCreditGrantNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to delete credit grant: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const localKeyRandomBytes = 24
+
+func ListLocalKeysHandler(c *gin.Context) {
+	mappings, err := db.ListMappingsBySource(dbmodule.KeyMappingSourceLocal, c.Query("namespace"))
+	if err != nil {
+		log.Errorf("Failed to list local keys: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"keys": mappings,
+	})
+}
+
+func CreateLocalKeyHandler(c *gin.Context) {
+	var req module.CreateLocalKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	if config.LocalKeyPrefix == "" {
+		c.JSON(http.StatusForbidden, module.NewForbiddenError("Local keys are disabled"))
+		return
+	}
+
+	key, err := generateLocalKey()
+	if err != nil {
+		log.Errorf("Failed to generate local key: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	mapping := &dbmodule.KeyMapping{
+		KeyHash:         db.HashKey(key),
+		KeyPrefix:       db.KeyPrefix(key),
+		Namespace:       req.Namespace,
+		Source:          dbmodule.KeyMappingSourceLocal,
+		LastValidatedAt: time.Now(),
+	}
+
+	if err := db.CreateMapping(middleware.AuditFromContext(c), mapping); err != nil {
+		log.Errorf("Failed to create local key: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusCreated, &module.CreateLocalKeyResponse{
+		Key:       key,
+		KeyHash:   mapping.KeyHash,
+		KeyPrefix: mapping.KeyPrefix,
+		Namespace: mapping.Namespace,
+		CreatedAt: mapping.CreatedAt.UnixMilli(),
+	})
+}
+
+func RevokeLocalKeyHandler(c *gin.Context) {
+	err := db.DeleteMappingBySource(
+		middleware.AuditFromContext(c),
+		c.Param("key_hash"),
+		dbmodule.KeyMappingSourceLocal,
+	)
+	if err != nil {
+		if errors.Is(err, db.ErrMappingNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to revoke local key: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func generateLocalKey() (string, error) {
+	b := make([]byte, localKeyRandomBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return config.LocalKeyPrefix + hex.EncodeToString(b), nil
+}
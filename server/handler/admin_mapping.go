@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// parsePagination 解析page和page_size参数，page从1开始
+func parsePagination(c *gin.Context) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	pageSize, _ = strconv.Atoi(c.Query("page_size"))
+	if pageSize < 1 {
+		pageSize = defaultPageSize
+	}
+
+	return page, min(pageSize, maxPageSize)
+}
+
+func ListMappingsHandler(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	filter := db.MappingFilter{
+		Namespace: c.Query("namespace"),
+		// 前缀展示时带有省略号，方便直接粘贴
+		KeyPrefix: strings.TrimSuffix(c.Query("key_prefix"), "..."),
+	}
+
+	mappings, total, err := db.ListMappings(filter, pageSize, (page-1)*pageSize)
+	if err != nil {
+		log.Errorf("Failed to list mappings: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mappings":  mappings,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func GetMappingHandler(c *gin.Context) {
+	mapping, err := db.GetMapping(c.Param("key_hash"))
+	if err != nil {
+		if errors.Is(err, db.ErrMappingNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to get mapping: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+
+		return
+	}
+
+	c.JSON(http.StatusOK, mapping)
+}
+
+// UpdateMappingHandler moves a key to another namespace. The move is pinned
+// unless the request sets pinned to false: revalidation then only checks that
+// the key is still accepted upstream and keeps the namespace set here.
+func UpdateMappingHandler(c *gin.Context) {
+	var req module.UpdateMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	keyHash := c.Param("key_hash")
+	pinned := req.Pinned == nil || *req.Pinned
+
+	err := db.UpdateMapping(middleware.AuditFromContext(c), keyHash, req.Namespace, pinned)
+	if err != nil {
+		if errors.Is(err, db.ErrMappingNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to update mapping: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+
+		return
+	}
+
+	mapping, err := db.GetMapping(keyHash)
+	if err != nil {
+		log.Errorf("Failed to get updated mapping: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, mapping)
+}
+
+func DeleteMappingHandler(c *gin.Context) {
+	if err := db.DeleteMapping(middleware.AuditFromContext(c), c.Param("key_hash")); err != nil {
+		if errors.Is(err, db.ErrMappingNotFound) {
+			c.JSON(http.StatusNotFound, module.NewNotFoundError(err.Error()))
+			return
+		}
+
+		log.Errorf("Failed to delete mapping: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func ListNamespaceKeysHandler(c *gin.Context) {
+	namespace := c.Param("namespace")
+	page, pageSize := parsePagination(c)
+
+	mappings, total, err := db.ListMappings(
+		db.MappingFilter{Namespace: namespace},
+		pageSize,
+		(page-1)*pageSize,
+	)
+	if err != nil {
+		log.Errorf("Failed to list namespace keys: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"namespace": namespace,
+		"count":     total,
+		"keys":      mappings,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+// GetPlanHandler returns the saved plan, the limits in effect and the limits
+// configured through the environment that apply when no plan is saved
+func GetPlanHandler(c *gin.Context) {
+	plan, err := db.GetPlan(dbmodule.PlanDefault)
+	if err != nil && !errors.Is(err, db.ErrPlanNotFound) {
+		log.Errorf("Failed to get plan: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"plan":     plan,
+		"policy":   db.EnforcedLimitPolicy(),
+		"defaults": config.EnforcedLimitPolicy(),
+	})
+}
+
+func UpdatePlanHandler(c *gin.Context) {
+	var req module.UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	if req.MonthlyLimitMode == "" {
+		req.MonthlyLimitMode = config.MonthlyLimitModeCalendar
+	}
+
+	plan := &dbmodule.Plan{
+		ID:                  dbmodule.PlanDefault,
+		DailyRequestLimit:   req.DailyRequestLimit,
+		MonthlyRequestLimit: req.MonthlyRequestLimit,
+		MonthlyLimitMode:    req.MonthlyLimitMode,
+		UpdatedBy:           c.GetString(middleware.AdminActorKey),
+	}
+
+	if err := db.SavePlan(middleware.AuditFromContext(c), plan); err != nil {
+		log.Errorf("Failed to save plan: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// DeletePlanHandler drops the saved plan, the limits configured through the
+// environment apply again
+func DeletePlanHandler(c *gin.Context) {
+	err := db.DeletePlan(middleware.AuditFromContext(c), dbmodule.PlanDefault)
+	if errors.Is(err, db.ErrPlanNotFound) {
+		c.JSON(http.StatusNotFound, module.NewNotFoundError("No plan is saved"))
+		return
+	}
+
+	if err != nil {
+		log.Errorf("Failed to delete plan: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+func quotaWindowOrDefault(window string) string {
+	if window == "" {
+		return dbmodule.QuotaWindowDay
+	}
+
+	return window
+}
+
+func ListCountedRequestsHandler(c *gin.Context) {
+	window := quotaWindowOrDefault(c.Query("window"))
+	if window != dbmodule.QuotaWindowDay && window != dbmodule.QuotaWindowMonth {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("window must be day or month"))
+		return
+	}
+
+	namespace := c.Param("namespace")
+
+	records, err := db.ListCountedRequests(namespace, window)
+	if err != nil {
+		log.Errorf("Failed to list counted requests: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"namespace": namespace,
+		"window":    window,
+		"count":     len(records),
+		"records":   records,
+	})
+}
+
+// ResetQuotaHandler voids the counted requests of a namespace, the body is
+// optional and an empty one resets the daily window
+func ResetQuotaHandler(c *gin.Context) {
+	var req module.ResetQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	adjustment := &dbmodule.QuotaAdjustment{
+		Namespace: c.Param("namespace"),
+		Window:    quotaWindowOrDefault(req.Window),
+		Reason:    req.Reason,
+		CreatedBy: c.GetString(middleware.AdminActorKey),
+	}
+
+	if err := db.ResetQuota(middleware.AuditFromContext(c), adjustment); err != nil {
+		log.Errorf("Failed to reset quota: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustment)
+}
+
+func AdjustQuotaHandler(c *gin.Context) {
+	var req module.AdjustQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	adjustment := &dbmodule.QuotaAdjustment{
+		Namespace: c.Param("namespace"),
+		Window:    quotaWindowOrDefault(req.Window),
+		Amount:    req.Delta,
+		Reason:    req.Reason,
+		CreatedBy: c.GetString(middleware.AdminActorKey),
+	}
+
+	var err error
+	if req.Delta > 0 {
+		err = db.AddQuotaUsage(middleware.AuditFromContext(c), adjustment)
+	} else {
+		adjustment.Amount = -req.Delta
+		err = db.SubtractQuotaUsage(middleware.AuditFromContext(c), adjustment)
+	}
+
+	if err != nil {
+		log.Errorf("Failed to adjust quota: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, adjustment)
+}
+
+func ListQuotaAdjustmentsHandler(c *gin.Context) {
+	page, pageSize := parsePagination(c)
+
+	adjustments, err := db.ListQuotaAdjustments(
+		c.Param("namespace"),
+		pageSize,
+		(page-1)*pageSize,
+	)
+	if err != nil {
+		log.Errorf("Failed to list quota adjustments: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"adjustments": adjustments,
+		"page":        page,
+		"page_size":   pageSize,
+	})
+}
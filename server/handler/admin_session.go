@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// adminSessionPath scopes the session cookie to the admin API and dashboard
+	adminSessionPath = "/admin"
+	// anonymousAdminActor is the actor of failed logins, the name given with a
+	// wrong token is unverified and only kept in the event payload
+	anonymousAdminActor = "anonymous"
+)
+
+// AdminLoginHandler exchanges the admin token for a dashboard session cookie
+func AdminLoginHandler(c *gin.Context) {
+	if config.AdminToken == "" {
+		c.JSON(http.StatusForbidden, module.NewForbiddenError("Admin API is disabled"))
+		return
+	}
+
+	var req module.AdminLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, module.NewInvalidRequestError(err.Error()))
+		return
+	}
+
+	if !middleware.CheckAdminToken(req.Token) {
+		recordLoginAudit(
+			c,
+			dbmodule.AuditActionAdminLoginFailed,
+			anonymousAdminActor,
+			gin.H{"claimed_actor": req.Actor},
+		)
+		c.JSON(http.StatusUnauthorized, module.NewAuthenticationError("Invalid admin token"))
+		return
+	}
+
+	actor := req.Actor
+	if actor == "" {
+		actor = "admin"
+	}
+
+	recordLoginAudit(c, dbmodule.AuditActionAdminLogin, actor, nil)
+
+	value, expiresAt := middleware.NewAdminSession(actor, time.Now())
+	setAdminSessionCookie(c, value, int(time.Until(expiresAt).Seconds()))
+
+	c.JSON(http.StatusOK, gin.H{
+		"actor":      actor,
+		"expires_at": expiresAt.UnixMilli(),
+	})
+}
+
+func recordLoginAudit(c *gin.Context, action, actor string, payload any) {
+	audit := middleware.AuditFromContext(c)
+	audit.Actor = actor
+
+	err := db.RecordAuditEvent(audit, action, dbmodule.AuditTargetIP, c.ClientIP(), nil, payload)
+	if err != nil {
+		log.Errorf("Failed to record admin login: %v", err)
+	}
+}
+
+func AdminLogoutHandler(c *gin.Context) {
+	setAdminSessionCookie(c, "", -1)
+	c.Status(http.StatusNoContent)
+}
+
+func setAdminSessionCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(middleware.AdminSessionCookie, value, maxAge, adminSessionPath, "", secure, true)
+}
+
+// AdminWhoAmIHandler returns the actor of the current admin credential, the
+// dashboard uses it to check whether its session is still valid
+func AdminWhoAmIHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"actor": c.GetString(middleware.AdminActorKey),
+	})
+}
+
+// LimitsHandler returns the limit policies, the enforced policy is the saved
+// plan if there is one, the other limits are configured through the environment
+func LimitsHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enforced_policy":              db.EnforcedLimitPolicy(),
+		"shadow_policy":                config.ShadowLimitPolicy,
+		"ip_daily_request_limit":       config.IPDailyRequestLimit,
+		"ip_burst_limit":               config.IPBurstLimit,
+		"global_daily_request_limit":   config.GlobalDailyRequestLimit,
+		"global_monthly_request_limit": config.GlobalMonthlyRequestLimit,
+		"global_daily_token_limit":     config.GlobalDailyTokenLimit,
+		"global_monthly_token_limit":   config.GlobalMonthlyTokenLimit,
+	})
+}
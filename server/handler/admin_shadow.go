@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultShadowDays = 7
+	maxShadowDays     = 90
+)
+
+// ShadowStatsHandler returns the shadow policy and the per namespace decision
+// differences of all replicas over the last days days, today included
+func ShadowStatsHandler(c *gin.Context) {
+	days := defaultShadowDays
+
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxShadowDays {
+			c.JSON(
+				http.StatusBadRequest,
+				module.NewInvalidRequestError(
+					"days must be between 1 and "+strconv.Itoa(maxShadowDays),
+				),
+			)
+
+			return
+		}
+
+		days = n
+	}
+
+	from := time.Now().AddDate(0, 0, 1-days)
+
+	namespaces, err := db.SumShadowDecisions(from)
+	if err != nil {
+		log.Errorf("Failed to get shadow decisions: %v", err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enforced_policy": db.EnforcedLimitPolicy(),
+		"shadow_policy":   config.ShadowLimitPolicy,
+		"from":            from.Format(time.DateOnly),
+		"namespaces":      namespaces,
+	})
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxBillingUsageDays 与OpenAI一致，一次最多查询100天
+	maxBillingUsageDays = 100
+	billingPlanID       = "free"
+	billingPlanTitle    = "Free"
+	billingLineItemName = "Requests"
+)
+
+// BillingSubscriptionHandler 把当前的请求额度按单价换算成hard_limit_usd，
+// 额度为当前窗口已使用和剩余的请求数加上有效的奖励额度
+func BillingSubscriptionHandler(c *gin.Context) {
+	namespace := c.GetString(middleware.NamespaceKey)
+	if namespace == "" {
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	usage, err := getUsage(namespace)
+	if err != nil {
+		log.Errorf("Failed to get usage for namespace %s: %v", namespace, err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	used, remaining := billingQuota(usage)
+	limit := requestsToUSD(used + remaining)
+
+	c.JSON(http.StatusOK, &module.BillingSubscriptionResponse{
+		Object:             "billing_subscription",
+		SoftLimitUSD:       limit,
+		HardLimitUSD:       limit,
+		SystemHardLimitUSD: limit,
+		AccessUntil:        usage.NextResetTime / 1000,
+		Plan: module.BillingPlan{
+			Title: billingPlanTitle,
+			ID:    billingPlanID,
+		},
+	})
+}
+
+// BillingUsageHandler 返回当前额度窗口已使用的请求数换算成的美分，
+// 客户端用hard_limit_usd减去total_usage显示剩余额度，所以total_usage不随查询的日期范围变化，
+// 日期范围只决定daily_costs
+func BillingUsageHandler(c *gin.Context) {
+	namespace := c.GetString(middleware.NamespaceKey)
+	if namespace == "" {
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	from, to, ok := parseBillingDateRange(c)
+	if !ok {
+		return
+	}
+
+	usage, err := getUsage(namespace)
+	if err != nil {
+		log.Errorf("Failed to get usage for namespace %s: %v", namespace, err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	buckets, err := db.DailyUsageSeries(namespace, from, to)
+	if err != nil {
+		log.Errorf("Failed to get usage series for namespace %s: %v", namespace, err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	used, _ := billingQuota(usage)
+
+	response := &module.BillingUsageResponse{
+		Object:     "list",
+		TotalUsage: requestsToUSD(used) * 100,
+		DailyCosts: make([]module.BillingDailyCost, 0, len(buckets)),
+	}
+
+	for _, bucket := range buckets {
+		response.DailyCosts = append(response.DailyCosts, module.BillingDailyCost{
+			Timestamp: float64(bucket.Time) / 1000,
+			LineItems: []module.BillingLineItem{{
+				Name: billingLineItemName,
+				Cost: requestsToUSD(bucket.Requests) * 100,
+			}},
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// billingQuota 返回当前能用的额度中已使用和剩余的请求数，包括奖励额度
+func billingQuota(usage *module.UsageResponse) (used, remaining int64) {
+	used = usage.UsedToday
+	remaining = usage.RemainingToday
+
+	for _, grant := range usage.Grants {
+		used += grant.Used
+		remaining += grant.Remaining
+	}
+
+	return used, remaining
+}
+
+// requestsToUSD 按单价换算，保留到0.0001美元避免浮点误差
+func requestsToUSD(requests int64) float64 {
+	return math.Round(float64(requests)*config.BillingUnitPrice*10000) / 10000
+}
+
+// parseBillingDateRange 解析start_date和end_date（本地时区，end_date不包含），
+// 默认为本月1日到明天
+func parseBillingDateRange(c *gin.Context) (from, to time.Time, ok bool) {
+	now := time.Now()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+
+	if v := c.Query("start_date"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("invalid start_date"))
+			return time.Time{}, time.Time{}, false
+		}
+
+		from = t
+	}
+
+	if v := c.Query("end_date"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("invalid end_date"))
+			return time.Time{}, time.Time{}, false
+		}
+
+		to = t
+	}
+
+	if !to.After(from) {
+		c.JSON(
+			http.StatusBadRequest,
+			module.NewInvalidRequestError("end_date must be after start_date"),
+		)
+
+		return time.Time{}, time.Time{}, false
+	}
+
+	if from.AddDate(0, 0, maxBillingUsageDays).Before(to) {
+		c.JSON(
+			http.StatusBadRequest,
+			module.NewInvalidRequestError("usage can be queried for at most 100 days"),
+		)
+
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
@@ -1,16 +1,23 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy-free/config"
 	"github.com/labring/aiproxy-free/db"
 	"github.com/labring/aiproxy-free/server/middleware"
 	"github.com/labring/aiproxy-free/server/module"
+	"github.com/labring/aiproxy-free/utils/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -36,28 +43,75 @@ func UsageHandler(c *gin.Context) {
 		return
 	}
 
-	usedToday, nextResetTime, err := db.GetUsageInfo(namespace)
+	response, err := getUsage(namespace)
 	if err != nil {
-		log.Errorf("Failed to get usage info for namespace %s: %v", namespace, err)
+		log.Errorf("Failed to get usage for namespace %s: %v", namespace, err)
 		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
 		return
 	}
 
-	totalLimit := config.DailyRequestLimit
+	c.JSON(http.StatusOK, response)
+}
+
+// getUsage 汇总某个namespace的每日、每月和奖励额度使用情况
+func getUsage(namespace string) (*module.UsageResponse, error) {
+	usedToday, nextResetTime, err := db.GetUsageInfo(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := db.EnforcedLimitPolicy()
+	totalLimit := policy.DailyRequestLimit
 
 	remainingToday := totalLimit - usedToday
 	if remainingToday < 0 {
 		remainingToday = 0
 	}
 
+	var usedThisMonth, remainingThisMonth, monthlyResetTime int64
+	if policy.MonthlyRequestLimit > 0 {
+		used, resetTime, err := db.GetMonthlyUsageInfo(namespace, policy.MonthlyLimitMode)
+		if err != nil {
+			return nil, err
+		}
+
+		usedThisMonth = used
+		remainingThisMonth = max(policy.MonthlyRequestLimit-used, 0)
+		monthlyResetTime = resetTime.UnixMilli()
+		remainingToday = min(remainingToday, remainingThisMonth)
+	}
+
+	grants, err := db.ListCreditGrants(namespace, true)
+	if err != nil {
+		return nil, err
+	}
+
 	response := &module.UsageResponse{
 		TotalLimit:     totalLimit,
 		UsedToday:      usedToday,
 		RemainingToday: remainingToday,
 		NextResetTime:  nextResetTime.UnixMilli(),
+		Grants:         make([]module.CreditGrantUsage, 0, len(grants)),
+
+		MonthlyLimit:       policy.MonthlyRequestLimit,
+		UsedThisMonth:      usedThisMonth,
+		RemainingThisMonth: remainingThisMonth,
+		MonthlyResetTime:   monthlyResetTime,
 	}
 
-	c.JSON(http.StatusOK, response)
+	for _, grant := range grants {
+		response.BonusRemaining += grant.Remaining()
+		response.Grants = append(response.Grants, module.CreditGrantUsage{
+			Amount:    grant.Amount,
+			Used:      grant.Used,
+			Remaining: grant.Remaining(),
+			Reason:    grant.Reason,
+			StartsAt:  grant.StartsAt.UnixMilli(),
+			ExpiresAt: grant.ExpiresAt.UnixMilli(),
+		})
+	}
+
+	return response, nil
 }
 
 var proxyResponseHeaders = []string{"Content-Type", "Content-Length"}
@@ -70,6 +124,8 @@ func proxyToOpenAI(c *gin.Context) {
 		return
 	}
 
+	body, stripUsage := forceStreamUsage(body)
+
 	req, err := http.NewRequestWithContext(
 		c.Request.Context(),
 		c.Request.Method,
@@ -86,9 +142,17 @@ func proxyToOpenAI(c *gin.Context) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Length", strconv.Itoa(len(body)))
 
+	result := &middleware.UpstreamResult{}
+	middleware.SetUpstreamResult(c, result)
+
+	start := time.Now()
+
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		log.Errorf("Failed to proxy request to upstream: %v", err)
+
+		result.ErrorType = "upstream_connection_error"
+
 		c.JSON(
 			http.StatusBadGateway,
 			module.NewBadGatewayError("Failed to connect to upstream API"),
@@ -102,6 +166,204 @@ func proxyToOpenAI(c *gin.Context) {
 		c.Header(h, resp.Header.Get(h))
 	}
 
+	stream := strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+	defer func() {
+		metrics.UpstreamDuration.
+			WithLabelValues(strconv.FormatBool(stream), strconv.Itoa(resp.StatusCode)).
+			Observe(metrics.Since(start))
+	}()
+
+	if stream {
+		c.Status(resp.StatusCode)
+		copyStream(c, resp.Body, result, start, stripUsage)
+
+		return
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		log.Errorf("Failed to read upstream response: %v", err)
+		c.Status(resp.StatusCode)
+		_, _ = c.Writer.Write(respBody)
+
+		return
+	}
+
+	inspectResponse(respBody, result)
+
+	c.Header("Content-Length", strconv.Itoa(len(respBody)))
 	c.Status(resp.StatusCode)
-	_, _ = io.Copy(c.Writer, resp.Body)
+
+	if _, err := c.Writer.Write(respBody); err == nil {
+		result.Completed = true
+	}
+}
+
+// forceStreamUsage 让流式请求总是带上stream_options.include_usage，上游只有这样才会在流的末尾
+// 返回token用量，全局token上限依赖这个用量。返回改写后的请求体，以及客户端原本是否没有要求用量，
+// 没有要求时转发流的时候需要去掉多出来的用量事件
+func forceStreamUsage(body []byte) ([]byte, bool) {
+	var req map[string]json.RawMessage
+	if err := sonic.Unmarshal(body, &req); err != nil {
+		return body, false
+	}
+
+	var stream bool
+	if err := sonic.Unmarshal(req["stream"], &stream); err != nil || !stream {
+		return body, false
+	}
+
+	options := map[string]json.RawMessage{}
+	if raw, ok := req["stream_options"]; ok && !bytes.Equal(raw, []byte("null")) {
+		if err := sonic.Unmarshal(raw, &options); err != nil {
+			return body, false
+		}
+	}
+
+	var includeUsage bool
+	if raw, ok := options["include_usage"]; ok {
+		if err := sonic.Unmarshal(raw, &includeUsage); err == nil && includeUsage {
+			return body, false
+		}
+	}
+
+	options["include_usage"] = json.RawMessage("true")
+
+	rawOptions, err := sonic.Marshal(options)
+	if err != nil {
+		return body, false
+	}
+
+	req["stream_options"] = rawOptions
+
+	rewritten, err := sonic.Marshal(req)
+	if err != nil {
+		return body, false
+	}
+
+	return rewritten, true
+}
+
+type upstreamResponse struct {
+	Error *struct {
+		Type string `json:"type"`
+	} `json:"error"`
+	Choices []struct {
+		Message *struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []any  `json:"tool_calls"`
+		} `json:"message"`
+		Delta *struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []any  `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Usage *struct {
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// inspectResponse 从非流式响应或者流式响应的单个事件中提取错误类型以及是否产生了token，
+// 返回这个事件是否只携带了用量，也就是include_usage时流末尾的用量事件
+func inspectResponse(data []byte, result *middleware.UpstreamResult) bool {
+	var resp upstreamResponse
+	if err := sonic.Unmarshal(data, &resp); err != nil {
+		return false
+	}
+
+	if resp.Error != nil && resp.Error.Type != "" {
+		result.ErrorType = resp.Error.Type
+	}
+
+	if resp.Usage != nil {
+		result.TotalTokens = max(result.TotalTokens, resp.Usage.TotalTokens)
+		if resp.Usage.CompletionTokens > 0 {
+			result.TokensProduced = true
+		}
+	}
+
+	for _, choice := range resp.Choices {
+		msg := choice.Message
+		if msg == nil {
+			msg = choice.Delta
+		}
+
+		if msg != nil &&
+			(msg.Content != "" || msg.ReasoningContent != "" || len(msg.ToolCalls) > 0) {
+			result.TokensProduced = true
+		}
+	}
+
+	return resp.Usage != nil && len(resp.Choices) == 0
+}
+
+var (
+	dataPrefix = []byte("data:")
+	doneData   = []byte("[DONE]")
+)
+
+// copyStream 逐行转发SSE响应，同时记录流是否完整结束以及是否产生了token，
+// stripUsage时不转发客户端没有要求的用量事件
+func copyStream(
+	c *gin.Context,
+	body io.Reader,
+	result *middleware.UpstreamResult,
+	start time.Time,
+	stripUsage bool,
+) {
+	reader := bufio.NewReader(body)
+	firstByte := true
+	skipBlank := false
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if firstByte {
+				metrics.UpstreamTTFB.Observe(metrics.Since(start))
+				firstByte = false
+			}
+
+			trimmed := bytes.TrimSpace(line)
+			write, done := true, false
+
+			if data, ok := bytes.CutPrefix(trimmed, dataPrefix); ok {
+				data = bytes.TrimSpace(data)
+				if bytes.Equal(data, doneData) {
+					done = true
+				} else if inspectResponse(data, result) && stripUsage {
+					// 连同事件后面的空行一起去掉，客户端看到的流和没有强制用量时一样
+					write, skipBlank = false, true
+				}
+			} else if len(trimmed) == 0 && skipBlank {
+				write, skipBlank = false, false
+			}
+
+			if write {
+				if _, writeErr := c.Writer.Write(line); writeErr != nil {
+					return
+				}
+			}
+
+			if done {
+				result.Completed = true
+			}
+
+			if len(trimmed) == 0 {
+				c.Writer.Flush()
+			}
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Errorf("Failed to read upstream stream: %v", err)
+			}
+
+			c.Writer.Flush()
+
+			return
+		}
+	}
 }
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/middleware"
+	"github.com/labring/aiproxy-free/server/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultUsageHistoryDays = 7
+	// maxUsageHistoryDays 不限制保留时间时最多查询的天数
+	maxUsageHistoryDays = 366
+)
+
+// UsageHistoryHandler 返回当前key所属namespace最近days天每天的请求数和按模型的统计，
+// 查询范围不能超过请求记录的保留时间
+func UsageHistoryHandler(c *gin.Context) {
+	namespace := c.GetString(middleware.NamespaceKey)
+	if namespace == "" {
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	maxDays := maxUsageHistoryDays
+	if config.UsageRetention > 0 {
+		maxDays = max(int(config.UsageRetention/(24*time.Hour)), 1)
+	}
+
+	days := defaultUsageHistoryDays
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, module.NewInvalidRequestError("invalid days"))
+			return
+		}
+
+		if n > maxDays {
+			c.JSON(
+				http.StatusBadRequest,
+				module.NewInvalidRequestError(
+					"days must not exceed "+strconv.Itoa(maxDays),
+				),
+			)
+
+			return
+		}
+
+		days = n
+	}
+
+	days = min(days, maxDays)
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day()-(days-1), 0, 0, 0, 0, now.Location())
+
+	buckets, err := db.DailyUsageSeries(namespace, from, now)
+	if err != nil {
+		log.Errorf("Failed to get usage history for namespace %s: %v", namespace, err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	models, err := db.UsageByModel(namespace, from, now)
+	if err != nil {
+		log.Errorf("Failed to get model usage for namespace %s: %v", namespace, err)
+		c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+		return
+	}
+
+	byDate := make(map[string]db.UsageBucket, len(buckets))
+	for _, bucket := range buckets {
+		byDate[time.UnixMilli(bucket.Time).Format(time.DateOnly)] = bucket
+	}
+
+	response := &module.UsageHistoryResponse{
+		Days:   make([]module.DailyUsage, 0, days),
+		Models: make([]module.ModelUsage, 0, len(models)),
+	}
+
+	// 按日历日期逐天填充，没有请求的日期补0
+	for i := range days {
+		date := time.Date(from.Year(), from.Month(), from.Day()+i, 0, 0, 0, 0, from.Location()).
+			Format(time.DateOnly)
+		bucket := byDate[date]
+
+		response.Days = append(response.Days, module.DailyUsage{
+			Date:     date,
+			Requests: bucket.Requests,
+			Refunded: bucket.Refunded,
+			Rejected: bucket.Rejected,
+		})
+	}
+
+	for _, usage := range models {
+		response.Models = append(response.Models, module.ModelUsage{
+			Model:    usage.Model,
+			Requests: usage.Requests,
+			Refunded: usage.Refunded,
+			Rejected: usage.Rejected,
+		})
+	}
+
+	c.JSON(http.StatusOK, response)
+}
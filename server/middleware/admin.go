@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/server/module"
+)
+
+const (
+	AdminActorKey     = "admin_actor"
+	AdminActorHeader  = "X-Admin-Actor"
+	defaultAdminActor = "admin"
+)
+
+// AdminAuthMiddleware protects the admin API with config.AdminToken, either as
+// a bearer token or through a dashboard session cookie. The admin API is
+// disabled entirely when no token is configured.
+func AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.AdminToken == "" {
+			c.JSON(http.StatusForbidden, module.NewForbiddenError("Admin API is disabled"))
+			c.Abort()
+
+			return
+		}
+
+		if c.GetHeader("Authorization") == "" {
+			adminSessionAuth(c)
+			return
+		}
+
+		if !CheckAdminToken(extractAPIKey(c.GetHeader("Authorization"))) {
+			c.JSON(http.StatusUnauthorized, module.NewAuthenticationError("Invalid admin token"))
+			c.Abort()
+
+			return
+		}
+
+		actor := c.GetHeader(AdminActorHeader)
+		if actor == "" {
+			actor = defaultAdminActor
+		}
+
+		c.Set(AdminActorKey, actor)
+		c.Next()
+	}
+}
+
+// CheckAdminToken compares token with config.AdminToken in constant time
+func CheckAdminToken(token string) bool {
+	return config.AdminToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) == 1
+}
+
+func adminSessionAuth(c *gin.Context) {
+	cookie, err := c.Cookie(AdminSessionCookie)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, module.NewAuthenticationError("Admin token required"))
+		c.Abort()
+
+		return
+	}
+
+	actor, ok := parseAdminSession(cookie, time.Now())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, module.NewAuthenticationError("Session expired"))
+		c.Abort()
+
+		return
+	}
+
+	if c.Request.Method != http.MethodGet && c.GetHeader(AdminSessionHeader) == "" {
+		c.JSON(
+			http.StatusForbidden,
+			module.NewForbiddenError(AdminSessionHeader+" header required"),
+		)
+		c.Abort()
+
+		return
+	}
+
+	c.Set(AdminActorKey, actor)
+	c.Next()
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+)
+
+const (
+	// AdminSessionCookie carries the dashboard login session
+	AdminSessionCookie = "aiproxy_admin_session"
+	// AdminSessionHeader must be sent with cookie authenticated writes, browsers
+	// do not send custom headers cross site without CORS which guards against CSRF
+	AdminSessionHeader = "X-Admin-Session"
+)
+
+// NewAdminSession returns a signed session cookie value for actor, the session
+// is signed with the admin token so rotating the token logs everyone out
+func NewAdminSession(actor string, now time.Time) (string, time.Time) {
+	expiresAt := now.Add(config.AdminSessionTTL)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(actor)) + "." +
+		strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return payload + "." + signAdminSession(payload), expiresAt
+}
+
+// parseAdminSession verifies a session cookie value and returns its actor
+func parseAdminSession(value string, now time.Time) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 || config.AdminToken == "" {
+		return "", false
+	}
+
+	payload, sig := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(signAdminSession(payload))) {
+		return "", false
+	}
+
+	encodedActor, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return "", false
+	}
+
+	actor, err := base64.RawURLEncoding.DecodeString(encodedActor)
+	if err != nil {
+		return "", false
+	}
+
+	return string(actor), true
+}
+
+func signAdminSession(payload string) string {
+	mac := hmac.New(sha256.New, []byte("admin-session:"+config.AdminToken))
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
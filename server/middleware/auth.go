@@ -10,7 +10,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy-free/config"
 	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
 	"github.com/labring/aiproxy-free/server/module"
+	"github.com/labring/aiproxy-free/server/resolver"
+	"github.com/labring/aiproxy-free/utils/jwt"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -18,43 +21,66 @@ const (
 	NamespaceKey = "namespace"
 )
 
+// IPBanMiddleware rejects banned client IPs, it runs before the IP limiters so
+// banned clients use up neither IP quota nor database writes
+func IPBanMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ban, ok := findBan(dbmodule.BanTargetIP, c.ClientIP()); ok {
+			abortSuspended(c, ban)
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(
-				http.StatusUnauthorized,
-				module.NewAuthenticationError("Authorization header required"),
-			)
+		apiKey, err := extractCredential(c.Request)
+		if err != nil {
+			message := "Invalid authorization format"
+			if errors.Is(err, errMissingCredential) {
+				message = "API key required"
+			}
+
+			c.JSON(http.StatusUnauthorized, module.NewAuthenticationError(message))
 			c.Abort()
 
 			return
 		}
 
-		apiKey := extractAPIKey(authHeader)
-		if apiKey == "" {
-			c.JSON(
-				http.StatusUnauthorized,
-				module.NewAuthenticationError("Invalid authorization format"),
-			)
-			c.Abort()
-
+		if ban, ok := findBan(dbmodule.BanTargetKey, db.HashKey(apiKey)); ok {
+			abortSuspended(c, ban)
 			return
 		}
 
 		namespace, err := getOrCreateNamespace(c.Request.Context(), apiKey)
 		if err != nil {
-			log.Errorf("Failed to get/create namespace for key %s: %v", apiKey, err)
+			log.Errorf(
+				"Failed to get/create namespace for key %s: %v",
+				db.KeyPrefix(apiKey),
+				err,
+			)
 			c.JSON(http.StatusUnauthorized, module.NewAuthenticationError("Invalid API key"))
 			c.Abort()
 			return
 		}
 
+		if ban, ok := findBan(dbmodule.BanTargetNamespace, namespace); ok {
+			abortSuspended(c, ban)
+			return
+		}
+
 		c.Set(NamespaceKey, namespace)
 		c.Next()
 	}
 }
 
+func abortSuspended(c *gin.Context, ban dbmodule.Ban) {
+	c.JSON(http.StatusForbidden, module.NewAccountSuspendedError(banMessage(ban)))
+	c.Abort()
+}
+
 func extractAPIKey(authHeader string) string {
 	if strings.HasPrefix(authHeader, "Bearer ") {
 		return strings.TrimPrefix(authHeader, "Bearer ")
@@ -63,58 +89,82 @@ func extractAPIKey(authHeader string) string {
 }
 
 func getOrCreateNamespace(ctx context.Context, key string) (string, error) {
-	namespace, err := db.GetNamespace(key)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			ns, authorized := checkKeyAndGetNamespace(ctx, key)
-			if !authorized {
-				return "", errors.New("key not authorized")
+	// JWT在本地校验且自带namespace，不需要查询映射
+	if jwt.LooksLikeJWT(key) {
+		if r, ok := resolver.Default().Get(resolver.JWTName); ok {
+			result, err := r.Resolve(ctx, key)
+			if err != nil {
+				return "", err
 			}
 
-			if ns == "" {
-				return "", errors.New("upstream implementation is incorrect: missing Group header")
-			}
+			return result.Namespace, nil
+		}
+	}
 
-			err = db.SaveMapping(key, ns)
-			if err != nil {
-				return "", fmt.Errorf("failed to save mapping: %w", err)
+	keyHash := db.HashKey(key)
+
+	if isKeyRejected(keyHash) {
+		return "", resolver.ErrUnauthorized
+	}
+
+	mapping, err := db.GetMapping(keyHash)
+	if err != nil {
+		if errors.Is(err, db.ErrMappingNotFound) {
+			// 本地签发的key只存在于数据库中，找不到说明已经吊销或者不存在，不需要询问上游
+			if isLocalKey(key) {
+				rejectKey(keyHash)
+				return "", resolver.ErrUnauthorized
 			}
 
-			return ns, nil
+			return createNamespace(ctx, key, keyHash)
 		}
 
 		return "", err
 	}
 
-	return namespace, nil
+	return revalidateIfStale(ctx, key, mapping)
 }
 
-func checkKeyAndGetNamespace(ctx context.Context, key string) (string, bool) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		config.UpstreamBaseURL+"/v1/models",
-		nil,
-	)
-	if err != nil {
-		log.Errorf("Failed to create permission check request: %v", err)
-		return "", false
-	}
+func isLocalKey(key string) bool {
+	return config.LocalKeyPrefix != "" && strings.HasPrefix(key, config.LocalKeyPrefix)
+}
 
-	req.Header.Set("Authorization", "Bearer "+key)
+// createNamespace 通过resolver链解析新的key，需要持久化的结果保存为映射，
+// 同一个key的并发解析合并为一次，被明确拒绝的key会被记住一段时间
+func createNamespace(ctx context.Context, key, keyHash string) (string, error) {
+	v, err, _ := keyValidationGroup.Do(keyHash, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), keyValidationTimeout)
+		defer cancel()
 
-	resp, err := http.DefaultClient.Do(req)
+		result, r, err := resolver.Default().Resolve(ctx, key)
+		if err != nil {
+			if errors.Is(err, resolver.ErrUnauthorized) {
+				rejectKey(keyHash)
+				return "", err
+			}
+
+			return "", fmt.Errorf("failed to resolve key: %w", err)
+		}
+
+		if !result.Persist {
+			return result.Namespace, nil
+		}
+
+		err = db.SaveMapping(resolverAudit(ctx, r.Name()), keyHash, db.KeyPrefix(key), result.Namespace, r.Name())
+		if err != nil {
+			return "", fmt.Errorf("failed to save mapping: %w", err)
+		}
+
+		return result.Namespace, nil
+	})
 	if err != nil {
-		log.Errorf("Failed to check API key permission: %v", err)
-		return "", false
+		return "", err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", false
+	ns, ok := v.(string)
+	if !ok {
+		panic(fmt.Sprintf("namespace type error: %T, %v", v, v))
 	}
 
-	namespace := resp.Header.Get("Group")
-
-	return namespace, true
+	return ns, nil
 }
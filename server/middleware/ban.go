@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	dbmodule "github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/utils/snapshot"
+	log "github.com/sirupsen/logrus"
+)
+
+// banList is a snapshot of the active bans
+type banList struct {
+	exact    map[string]dbmodule.Ban
+	prefixes []bannedPrefix
+}
+
+type bannedPrefix struct {
+	prefix netip.Prefix
+	ban    dbmodule.Ban
+}
+
+// bans is reloaded from the database every config.BanRefreshInterval so bans
+// made on other replicas apply too
+var bans = snapshot.New(
+	loadBans,
+	func() time.Duration { return config.BanRefreshInterval },
+)
+
+func banKey(targetType, target string) string {
+	return targetType + ":" + target
+}
+
+// findBan returns the active ban of a target, ip targets also match banned CIDRs
+func findBan(targetType, target string) (dbmodule.Ban, bool) {
+	list := currentBans()
+	if list == nil {
+		return dbmodule.Ban{}, false
+	}
+
+	now := time.Now()
+
+	var addr netip.Addr
+
+	if targetType == dbmodule.BanTargetIP {
+		parsed, err := netip.ParseAddr(target)
+		if err != nil {
+			return dbmodule.Ban{}, false
+		}
+
+		// 和保存时一样统一IP的格式
+		addr = parsed.Unmap()
+		target = addr.String()
+	}
+
+	if ban, ok := list.exact[banKey(targetType, target)]; ok && ban.Active(now) {
+		return ban, true
+	}
+
+	if !addr.IsValid() {
+		return dbmodule.Ban{}, false
+	}
+
+	for _, p := range list.prefixes {
+		if p.prefix.Contains(addr) && p.ban.Active(now) {
+			return p.ban, true
+		}
+	}
+
+	return dbmodule.Ban{}, false
+}
+
+func currentBans() *banList {
+	list, err := bans.Get()
+	if err != nil {
+		// 加载失败时继续使用旧的封禁列表，稍后再重试
+		log.Errorf("Failed to load bans: %v", err)
+	}
+
+	return list
+}
+
+func loadBans() (*banList, error) {
+	active, err := db.ListBans("", true)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &banList{
+		exact: make(map[string]dbmodule.Ban, len(active)),
+	}
+
+	for _, ban := range active {
+		if ban.TargetType == dbmodule.BanTargetIP && strings.Contains(ban.Target, "/") {
+			prefix, err := netip.ParsePrefix(ban.Target)
+			if err != nil {
+				log.Warnf("Ignoring ban %d with invalid CIDR %q", ban.ID, ban.Target)
+				continue
+			}
+
+			list.prefixes = append(list.prefixes, bannedPrefix{prefix: prefix.Masked(), ban: ban})
+
+			continue
+		}
+
+		list.exact[banKey(ban.TargetType, ban.Target)] = ban
+	}
+
+	return list, nil
+}
+
+// ReloadBans drops the cached ban list so changes made on this replica apply
+// to the next request
+func ReloadBans() {
+	bans.Invalidate()
+}
+
+func banMessage(ban dbmodule.Ban) string {
+	message := "Account suspended"
+	if ban.Reason != "" {
+		message += ": " + ban.Reason
+	}
+
+	if ban.ExpiresAt != nil {
+		message += fmt.Sprintf(" (until %s)", ban.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	return message
+}
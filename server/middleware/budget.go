@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/module"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkGlobalBudget 检查所有namespace共享的全局预算，超出时返回提示信息
+func checkGlobalBudget(now time.Time) (string, bool) {
+	if config.GlobalDailyRequestLimit <= 0 && config.GlobalMonthlyRequestLimit <= 0 &&
+		config.GlobalDailyTokenLimit <= 0 && config.GlobalMonthlyTokenLimit <= 0 {
+		return "", true
+	}
+
+	day, month, err := db.GetGlobalUsage(now)
+	if err != nil {
+		log.Errorf("Failed to check global budget: %v", err)
+		return "", true
+	}
+
+	var exceeded *module.GlobalUsage
+
+	switch {
+	case exceedsLimit(day.Requests, config.GlobalDailyRequestLimit),
+		exceedsLimit(day.Tokens, config.GlobalDailyTokenLimit):
+		exceeded = &day
+	case exceedsLimit(month.Requests, config.GlobalMonthlyRequestLimit),
+		exceedsLimit(month.Tokens, config.GlobalMonthlyTokenLimit):
+		exceeded = &month
+	default:
+		return "", true
+	}
+
+	if exceeded.AlertedAt == nil {
+		go alertGlobalBudgetExhausted(*exceeded)
+	}
+
+	return "Free tier capacity exhausted, please try again later", false
+}
+
+func exceedsLimit(used, limit int64) bool {
+	return limit > 0 && used >= limit
+}
+
+// recordGlobalUsage 累加全局用量，失败只记录日志不影响请求
+func recordGlobalUsage(at time.Time, requests, tokens int64) {
+	if requests == 0 && tokens == 0 {
+		return
+	}
+
+	if err := db.IncrGlobalUsage(at, requests, tokens); err != nil {
+		log.Errorf("Failed to record global usage: %v", err)
+	}
+}
+
+// alertGlobalBudgetExhausted 把告警写入webhook发件箱，以周期作为去重key，
+// 每个周期只会有一个副本成功标记并记录日志
+func alertGlobalBudgetExhausted(usage module.GlobalUsage) {
+	_, err := db.EnqueueWebhook(
+		module.WebhookEventGlobalBudgetExhausted,
+		module.WebhookEventGlobalBudgetExhausted+":"+usage.Period,
+		&module.GlobalBudgetExhaustedEvent{
+			Period:                    usage.Period,
+			Requests:                  usage.Requests,
+			Tokens:                    usage.Tokens,
+			GlobalDailyRequestLimit:   config.GlobalDailyRequestLimit,
+			GlobalMonthlyRequestLimit: config.GlobalMonthlyRequestLimit,
+			GlobalDailyTokenLimit:     config.GlobalDailyTokenLimit,
+			GlobalMonthlyTokenLimit:   config.GlobalMonthlyTokenLimit,
+		},
+	)
+	if err != nil {
+		// 没有标记告警，下一个被拒绝的请求会重新写入
+		log.Errorf("Failed to enqueue global budget webhook: %v", err)
+		return
+	}
+
+	first, err := db.MarkGlobalUsageAlerted(usage.Period)
+	if err != nil {
+		log.Errorf("Failed to mark global budget alerted: %v", err)
+		return
+	}
+
+	if !first {
+		return
+	}
+
+	log.Warnf(
+		"Global budget exhausted for %s: %d requests, %d tokens",
+		usage.Period,
+		usage.Requests,
+		usage.Tokens,
+	)
+}
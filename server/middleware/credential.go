@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labring/aiproxy-free/config"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	errMissingCredential = errors.New("missing api key")
+	errInvalidCredential = errors.New("invalid authorization format")
+)
+
+// credentialExtractor reads an api key from one place of the request, ok is
+// false when the request carries nothing there and err reports a malformed value
+type credentialExtractor func(r *http.Request) (key string, ok bool, err error)
+
+var credentialExtractors = map[string]credentialExtractor{
+	// Authorization: Bearer <key>, or the raw header value for older clients
+	"authorization": func(r *http.Request) (string, bool, error) {
+		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" || hasAuthScheme(authHeader, "Basic") {
+			return "", false, nil
+		}
+
+		key := strings.TrimSpace(extractAPIKey(authHeader))
+		if key == "" {
+			return "", true, errInvalidCredential
+		}
+
+		return key, true, nil
+	},
+	// x-api-key: <key>, used by Anthropic clients
+	"x-api-key": headerCredential("X-Api-Key"),
+	// api-key: <key>, used by Azure OpenAI clients
+	"api-key": headerCredential("Api-Key"),
+	// x-goog-api-key: <key>, used by Gemini clients
+	"x-goog-api-key": headerCredential("X-Goog-Api-Key"),
+	// ?key=<key>, used by Gemini clients
+	"query": func(r *http.Request) (string, bool, error) {
+		if !r.URL.Query().Has("key") {
+			return "", false, nil
+		}
+
+		key := strings.TrimSpace(r.URL.Query().Get("key"))
+		if key == "" {
+			return "", true, errInvalidCredential
+		}
+
+		return key, true, nil
+	},
+	// Authorization: Basic base64(<anything>:<key>)
+	"basic": func(r *http.Request) (string, bool, error) {
+		if !hasAuthScheme(r.Header.Get("Authorization"), "Basic") {
+			return "", false, nil
+		}
+
+		_, key, ok := r.BasicAuth()
+		if !ok || key == "" {
+			return "", true, errInvalidCredential
+		}
+
+		return key, true, nil
+	},
+}
+
+func headerCredential(header string) credentialExtractor {
+	return func(r *http.Request) (string, bool, error) {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			return "", false, nil
+		}
+
+		key := strings.TrimSpace(values[0])
+		if key == "" {
+			return "", true, errInvalidCredential
+		}
+
+		return key, true, nil
+	}
+}
+
+func hasAuthScheme(authHeader, scheme string) bool {
+	return len(authHeader) > len(scheme) &&
+		strings.EqualFold(authHeader[:len(scheme)], scheme) &&
+		authHeader[len(scheme)] == ' '
+}
+
+// credentialChain is config.AuthCredentialSources resolved once, in precedence order
+var credentialChain = sync.OnceValue(func() []credentialExtractor {
+	chain := make([]credentialExtractor, 0, len(config.AuthCredentialSources))
+	for _, name := range config.AuthCredentialSources {
+		extractor, ok := credentialExtractors[strings.ToLower(name)]
+		if !ok {
+			log.Errorf("unknown auth credential source: %s", name)
+			continue
+		}
+
+		chain = append(chain, extractor)
+	}
+
+	return chain
+})
+
+// extractCredential returns the api key of the first configured source the
+// request carries a credential in
+func extractCredential(r *http.Request) (string, error) {
+	for _, extractor := range credentialChain() {
+		key, ok, err := extractor(r)
+		if !ok {
+			continue
+		}
+
+		return key, err
+	}
+
+	return "", errMissingCredential
+}
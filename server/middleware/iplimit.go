@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/server/module"
+	"github.com/labring/aiproxy-free/utils"
+	"github.com/labring/aiproxy-free/utils/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	ClientIPKey = "client_ip_key"
+)
+
+// IPBurstLimitMiddleware caps how many requests a single client IP may send
+// within config.IPBurstWindow, the counters live in memory of each replica
+func IPBurstLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.IPBurstLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		ip := clientIPKey(c)
+		if !ipBurstLimiter.allow(ip, config.IPBurstLimit, config.IPBurstWindow, time.Now()) {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimitIPBurst).Inc()
+			c.JSON(
+				http.StatusTooManyRequests,
+				module.NewRateLimitError("Too many requests from this IP, please slow down"),
+			)
+			c.Abort()
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// IPDailyLimitMiddleware caps how many requests a single client IP may send per
+// day, both valid and invalid keys are counted so that brute force traffic is
+// capped before it reaches the upstream key validation
+func IPDailyLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.IPDailyRequestLimit <= 0 {
+			c.Next()
+			return
+		}
+
+		ip := clientIPKey(c)
+
+		count, err := db.CountIPRequestsToday(ip)
+		if err != nil {
+			log.Errorf("Failed to check ip rate limit: %v", err)
+			c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+			c.Abort()
+
+			return
+		}
+
+		if count >= config.IPDailyRequestLimit {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimitIPDaily).Inc()
+			c.JSON(
+				http.StatusTooManyRequests,
+				module.NewRateLimitError(
+					fmt.Sprintf("Daily request limit for this IP (%d) exceeded", config.IPDailyRequestLimit),
+				),
+			)
+			c.Abort()
+
+			return
+		}
+
+		if err := db.AddIPRequest(ip); err != nil {
+			log.Errorf("Failed to record ip request: %v", err)
+			c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+			c.Abort()
+
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func clientIPKey(c *gin.Context) string {
+	if key := c.GetString(ClientIPKey); key != "" {
+		return key
+	}
+
+	key := utils.IPLimitKey(c.ClientIP(), int(config.IPv6PrefixLength))
+	c.Set(ClientIPKey, key)
+
+	return key
+}
+
+var ipBurstLimiter = newBurstLimiter()
+
+type burstWindow struct {
+	start time.Time
+	count int64
+}
+
+// burstLimiter is a fixed window counter keyed by client IP
+type burstLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*burstWindow
+	lastSweep time.Time
+}
+
+func newBurstLimiter() *burstLimiter {
+	return &burstLimiter{
+		windows: make(map[string]*burstWindow),
+	}
+}
+
+func (l *burstLimiter) allow(key string, limit int64, window time.Duration, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= window {
+				delete(l.windows, k)
+			}
+		}
+
+		l.lastSweep = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= window {
+		l.windows[key] = &burstWindow{start: now, count: 1}
+		return true
+	}
+
+	if w.count >= limit {
+		return false
+	}
+
+	w.count++
+
+	return true
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +31,10 @@ func NewLog(l *logrus.Logger) gin.HandlerFunc {
 			utils.PutLogFields(fields)
 		}()
 
+		if id := c.GetString(RequestIDKey); id != "" {
+			fields[RequestIDKey] = id
+		}
+
 		entry := &logrus.Entry{
 			Logger: l,
 			Data:   fields,
@@ -57,7 +62,7 @@ func NewLog(l *logrus.Logger) gin.HandlerFunc {
 		param.BodySize = c.Writer.Size()
 
 		if raw != "" {
-			path = path + "?" + raw
+			path = path + "?" + redactQuery(raw)
 		}
 
 		param.Path = path
@@ -66,6 +71,22 @@ func NewLog(l *logrus.Logger) gin.HandlerFunc {
 	}
 }
 
+// redactQuery hides api keys passed as query parameters from the access log
+func redactQuery(raw string) string {
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return "[invalid query]"
+	}
+
+	if !query.Has("key") {
+		return raw
+	}
+
+	query.Set("key", "REDACTED")
+
+	return query.Encode()
+}
+
 func logColor(log *logrus.Entry, p gin.LogFormatterParams) {
 	str := formatter(p)
 
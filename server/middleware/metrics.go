@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/utils/metrics"
+)
+
+const (
+	ModelKey = "model"
+
+	unmatchedRoute = "unmatched"
+)
+
+// MetricsMiddleware counts requests by route template, status and model, the
+// route template keeps the label values bounded
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = unmatchedRoute
+		}
+
+		status := c.Writer.Status()
+		model := metrics.ModelLabel(
+			c.GetString(ModelKey),
+			status >= http.StatusOK && status < http.StatusMultipleChoices,
+		)
+
+		metrics.RequestsTotal.WithLabelValues(route, strconv.Itoa(status), model).Inc()
+		metrics.RequestDuration.WithLabelValues(route).Observe(metrics.Since(start))
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/utils/lru"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	notifiedThresholdCacheSize = 100000
+	// notifiedThresholdCacheTTL 覆盖一个完整的每日窗口，过期后去重依靠发件箱的唯一索引
+	notifiedThresholdCacheTTL = 25 * time.Hour
+)
+
+// notifiedThresholds 本副本已经写入过的阈值事件，避免超过阈值后每个请求都尝试写入发件箱
+var notifiedThresholds = lru.New[string, struct{}](
+	notifiedThresholdCacheSize,
+	notifiedThresholdCacheTTL,
+)
+
+// notifyQuotaThresholds 一个计入每日额度的请求使每日用量从before变为before+1后，
+// 为所有已经达到的阈值写入quota.threshold事件。并发请求可能读到相同的before而跨过阈值，
+// 所以只要达到阈值就写入，由去重key（包含日期）的唯一索引保证每天每个阈值最多通知一次
+func notifyQuotaThresholds(namespace string, now time.Time, limit, before int64) {
+	if len(config.WebhookEndpoints) == 0 || limit <= 0 {
+		return
+	}
+
+	used := before + 1
+	period := now.Format(time.DateOnly)
+
+	for _, threshold := range config.WebhookQuotaThresholds {
+		// 用乘法避免整数除法的截断
+		if used*100 < limit*threshold {
+			continue
+		}
+
+		dedupeKey := fmt.Sprintf(
+			"%s:%s:day:%s:%d",
+			module.WebhookEventQuotaThreshold,
+			namespace,
+			period,
+			threshold,
+		)
+
+		if _, ok := notifiedThresholds.Get(dedupeKey); ok {
+			continue
+		}
+
+		_, err := db.EnqueueWebhook(
+			module.WebhookEventQuotaThreshold,
+			dedupeKey,
+			&module.QuotaThresholdEvent{
+				Namespace: namespace,
+				Window:    "day",
+				Period:    period,
+				Threshold: threshold,
+				Used:      used,
+				Limit:     limit,
+			},
+		)
+		if err != nil {
+			log.Errorf("Failed to enqueue quota threshold webhook: %v", err)
+			continue
+		}
+
+		notifiedThresholds.Add(dedupeKey, struct{}{})
+	}
+}
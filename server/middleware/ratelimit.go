@@ -1,13 +1,19 @@
 package middleware
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy-free/config"
 	"github.com/labring/aiproxy-free/db"
 	"github.com/labring/aiproxy-free/server/module"
+	"github.com/labring/aiproxy-free/utils/metrics"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -20,43 +26,250 @@ func RateLimitMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		if !checkRateLimit(namespace) {
+		now := time.Now()
+		if message, ok := checkGlobalBudget(now); !ok {
+			metrics.RateLimitRejections.WithLabelValues(metrics.LimitGlobalBudget).Inc()
+			c.JSON(http.StatusServiceUnavailable, module.NewCapacityExhaustedError(message))
+			c.Abort()
+
+			return
+		}
+
+		model, err := requestModel(c)
+		if err != nil {
+			if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+				c.JSON(
+					http.StatusRequestEntityTooLarge,
+					module.NewRequestTooLargeError(fmt.Sprintf(
+						"Request body exceeds the limit of %d bytes",
+						maxBytesErr.Limit,
+					)),
+				)
+				c.Abort()
+
+				return
+			}
+
+			log.Errorf("Failed to read request body: %v", err)
 			c.JSON(
-				http.StatusTooManyRequests,
-				module.NewRateLimitError(
-					fmt.Sprintf("Daily request limit (%d) exceeded", config.DailyRequestLimit),
-				),
+				http.StatusBadRequest,
+				module.NewInvalidRequestError("Failed to read request body"),
 			)
 			c.Abort()
 
 			return
 		}
 
-		recordID, err := db.AddRequest(namespace)
+		c.Set(ModelKey, model)
+
+		usage := newNamespaceUsage(namespace)
+		policy := db.EnforcedLimitPolicy()
+
+		limitMessage, allowed, err := checkRateLimit(policy, usage)
 		if err != nil {
+			log.Errorf("Failed to check rate limit: %v", err)
+			c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
+			c.Abort()
+
+			return
+		}
+
+		checkShadowRateLimit(usage, allowed)
+
+		var recordID uint
+
+		// 每日和每月额度用完之后消耗奖励额度
+		if allowed {
+			recordID, err = db.AddRequest(namespace, model)
+		} else {
+			recordID, err = db.AddCreditRequest(namespace, model)
+		}
+
+		if err != nil {
+			if errors.Is(err, db.ErrNoCreditAvailable) {
+				// 被拒绝的请求只用于统计，记录失败不影响返回
+				if err := db.AddRejectedRequest(namespace, model); err != nil {
+					log.Errorf("Failed to record rejected request: %v", err)
+				}
+
+				metrics.RateLimitRejections.WithLabelValues(metrics.LimitNamespace).Inc()
+				c.JSON(http.StatusTooManyRequests, module.NewRateLimitError(limitMessage))
+				c.Abort()
+
+				return
+			}
+
 			log.Errorf("Failed to record request: %v", err)
 			c.JSON(http.StatusInternalServerError, module.NewInternalServerError())
 			c.Abort()
+
 			return
 		}
 
-		c.Next()
+		recordGlobalUsage(now, 1, 0)
 
-		// 如果响应状态不是200，删除之前添加的记录
-		if c.Writer.Status() != http.StatusOK {
-			if deleteErr := db.DeleteRequestByID(recordID); deleteErr != nil {
-				log.Errorf("Failed to delete request record for failed response: %v", deleteErr)
+		// 只有计入每日额度的请求才会推动每日用量，countToday已经缓存了请求之前的用量
+		if allowed {
+			if usedToday, err := usage.countToday(); err == nil {
+				notifyQuotaThresholds(namespace, now, policy.DailyRequestLimit, usedToday)
 			}
 		}
+
+		c.Next()
+
+		result := GetUpstreamResult(c)
+		if refundIfNeeded(c, namespace, recordID, result) {
+			recordGlobalUsage(now, -1, result.TotalTokens)
+		} else {
+			recordGlobalUsage(now, 0, result.TotalTokens)
+		}
 	}
 }
 
-func checkRateLimit(namespace string) bool {
-	count, err := db.CountRequestsToday(namespace)
-	if err != nil {
-		log.Errorf("Failed to check rate limit: %v", err)
+// refundIfNeeded 根据退款策略决定是否退还之前添加的记录，返回是否退还
+func refundIfNeeded(
+	c *gin.Context,
+	namespace string,
+	recordID uint,
+	result *UpstreamResult,
+) bool {
+	decision := DecideRefund(config.RefundPolicy, RefundInput{
+		StatusCode:     c.Writer.Status(),
+		ErrorType:      result.ErrorType,
+		TokensProduced: result.TokensProduced,
+		Completed:      result.Completed,
+		ClientCanceled: c.Request.Context().Err() != nil,
+	})
+	countRefundDecision(decision)
+
+	log.Infof(
+		"Refund decision for namespace %s record %d: %s (status: %d, error type: %q, tokens produced: %t, completed: %t)",
+		namespace,
+		recordID,
+		decision,
+		c.Writer.Status(),
+		result.ErrorType,
+		result.TokensProduced,
+		result.Completed,
+	)
+
+	if !decision.Refund {
+		return false
+	}
+
+	if err := db.RefundRequestByID(recordID); err != nil {
+		log.Errorf("Failed to refund request record: %v", err)
 		return false
 	}
 
-	return count < config.DailyRequestLimit
+	return true
+}
+
+// namespaceUsage 缓存一次请求中查询过的用量，避免执行和影子策略重复查询数据库
+type namespaceUsage struct {
+	namespace string
+	today     *int64
+	monthly   map[string]int64
+}
+
+func newNamespaceUsage(namespace string) *namespaceUsage {
+	return &namespaceUsage{
+		namespace: namespace,
+		monthly:   make(map[string]int64),
+	}
+}
+
+func (u *namespaceUsage) countToday() (int64, error) {
+	if u.today != nil {
+		return *u.today, nil
+	}
+
+	count, err := db.CountRequestsToday(u.namespace)
+	if err != nil {
+		return 0, err
+	}
+
+	u.today = &count
+
+	return count, nil
+}
+
+func (u *namespaceUsage) countThisMonth(mode string) (int64, error) {
+	if count, ok := u.monthly[mode]; ok {
+		return count, nil
+	}
+
+	count, err := db.CountRequestsThisMonth(u.namespace, mode)
+	if err != nil {
+		return 0, err
+	}
+
+	u.monthly[mode] = count
+
+	return count, nil
+}
+
+// checkRateLimit 检查每日和每月额度，超出时返回提示信息，查询用量失败时返回error，
+// 此时既不能认为超出额度也不能认为没有超出
+func checkRateLimit(policy config.LimitPolicy, usage *namespaceUsage) (string, bool, error) {
+	count, err := usage.countToday()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to count daily usage: %w", err)
+	}
+
+	if count >= policy.DailyRequestLimit {
+		return fmt.Sprintf("Daily request limit (%d) exceeded", policy.DailyRequestLimit), false, nil
+	}
+
+	if policy.MonthlyRequestLimit <= 0 {
+		return "", true, nil
+	}
+
+	count, err = usage.countThisMonth(policy.MonthlyLimitMode)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to count monthly usage: %w", err)
+	}
+
+	if count >= policy.MonthlyRequestLimit {
+		return fmt.Sprintf(
+			"Monthly request limit (%d) exceeded",
+			policy.MonthlyRequestLimit,
+		), false, nil
+	}
+
+	return "", true, nil
+}
+
+const maxModelLength = 128
+
+// requestModel 读取请求体中的model字段用于统计，然后恢复请求体供处理函数继续读取，
+// 请求体不是JSON时返回空字符串，请求体超过MaxRequestBodySize时返回*http.MaxBytesError
+func requestModel(c *gin.Context) (string, error) {
+	if c.Request.Body == nil {
+		return "", nil
+	}
+
+	if config.MaxRequestBodySize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.MaxRequestBodySize)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", err
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := sonic.Unmarshal(body, &req); err != nil {
+		return "", nil
+	}
+
+	if len(req.Model) > maxModelLength {
+		return req.Model[:maxModelLength], nil
+	}
+
+	return req.Model, nil
 }
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/config"
+)
+
+const (
+	UpstreamResultKey = "upstream_result"
+)
+
+// UpstreamResult describes how a proxied request ended, it is filled in by the
+// handler and consumed by the refund policy
+type UpstreamResult struct {
+	// ErrorType is the upstream error type, either from an error response or an
+	// error event inside a stream
+	ErrorType string
+	// TokensProduced reports whether the upstream generated any output
+	TokensProduced bool
+	// Completed reports whether the response body was fully delivered
+	Completed bool
+	// TotalTokens is the token usage reported by the upstream, streaming requests
+	// always ask the upstream for it through stream_options.include_usage
+	TotalTokens int64
+}
+
+func SetUpstreamResult(c *gin.Context, result *UpstreamResult) {
+	c.Set(UpstreamResultKey, result)
+}
+
+func GetUpstreamResult(c *gin.Context) *UpstreamResult {
+	v, ok := c.Get(UpstreamResultKey)
+	if !ok {
+		return &UpstreamResult{}
+	}
+
+	result, ok := v.(*UpstreamResult)
+	if !ok {
+		panic(fmt.Sprintf("upstream result type error: %T, %v", v, v))
+	}
+
+	return result
+}
+
+// RefundInput is everything the refund policy looks at
+type RefundInput struct {
+	StatusCode     int
+	ErrorType      string
+	TokensProduced bool
+	Completed      bool
+	ClientCanceled bool
+}
+
+// RefundDecision is the outcome of the refund policy
+type RefundDecision struct {
+	Refund bool
+	Reason string
+}
+
+func (d RefundDecision) String() string {
+	if d.Refund {
+		return "refund/" + d.Reason
+	}
+	return "charge/" + d.Reason
+}
+
+// DecideRefund evaluates the refund policy, the first matching rule wins. A
+// successful response that broke off on the upstream side is judged before the
+// tokens produced rule, since such a stream has usually produced tokens already,
+// while a client that canceled after receiving tokens is still charged.
+func DecideRefund(policy config.RefundPolicyConfig, in RefundInput) RefundDecision {
+	switch {
+	case in.ErrorType != "" && slices.Contains(policy.ChargeErrorTypes, in.ErrorType):
+		return RefundDecision{Refund: false, Reason: "error_type"}
+	case in.ErrorType != "" && slices.Contains(policy.RefundErrorTypes, in.ErrorType):
+		return RefundDecision{Refund: true, Reason: "error_type"}
+	case statusClass(in.StatusCode) == "2xx" && !in.Completed && !in.ClientCanceled:
+		return RefundDecision{Refund: policy.RefundIncompleteStreams, Reason: "incomplete_response"}
+	case in.TokensProduced && policy.ChargeProducedTokens:
+		return RefundDecision{Refund: false, Reason: "tokens_produced"}
+	case in.ClientCanceled:
+		return RefundDecision{Refund: policy.RefundClientCanceled, Reason: "client_canceled"}
+	case slices.Contains(policy.RefundStatusCodes, in.StatusCode):
+		return RefundDecision{Refund: true, Reason: "status_code"}
+	case slices.Contains(policy.RefundStatusClasses, statusClass(in.StatusCode)):
+		return RefundDecision{Refund: true, Reason: "status_class"}
+	default:
+		return RefundDecision{Refund: false, Reason: "default"}
+	}
+}
+
+func statusClass(code int) string {
+	return fmt.Sprintf("%dxx", code/100)
+}
+
+var refundDecisionCounter = struct {
+	sync.Mutex
+	counts map[string]int64
+}{
+	counts: make(map[string]int64),
+}
+
+func countRefundDecision(d RefundDecision) {
+	refundDecisionCounter.Lock()
+	defer refundDecisionCounter.Unlock()
+
+	refundDecisionCounter.counts[d.String()]++
+}
+
+// RefundDecisionCounts returns how many times each refund decision was made
+// since the process started
+func RefundDecisionCounts() map[string]int64 {
+	refundDecisionCounter.Lock()
+	defer refundDecisionCounter.Unlock()
+
+	return maps.Clone(refundDecisionCounter.counts)
+}
@@ -0,0 +1,125 @@
+package middleware_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/server/middleware"
+)
+
+func TestDecideRefund(t *testing.T) {
+	defaults := config.RefundPolicyConfig{
+		RefundStatusClasses:     []string{"5xx"},
+		RefundStatusCodes:       []int{http.StatusTooManyRequests},
+		ChargeProducedTokens:    true,
+		RefundIncompleteStreams: true,
+		RefundClientCanceled:    true,
+	}
+
+	withErrorTypes := defaults
+	withErrorTypes.RefundErrorTypes = []string{"server_error"}
+	withErrorTypes.ChargeErrorTypes = []string{"invalid_request_error"}
+
+	keepIncomplete := defaults
+	keepIncomplete.RefundIncompleteStreams = false
+
+	tests := []struct {
+		name   string
+		policy config.RefundPolicyConfig
+		in     middleware.RefundInput
+		want   middleware.RefundDecision
+	}{
+		{
+			name:   "completed success is charged",
+			policy: defaults,
+			in: middleware.RefundInput{
+				StatusCode:     http.StatusOK,
+				TokensProduced: true,
+				Completed:      true,
+			},
+			want: middleware.RefundDecision{Refund: false, Reason: "tokens_produced"},
+		},
+		{
+			name:   "completed success without tokens is charged",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusOK, Completed: true},
+			want:   middleware.RefundDecision{Refund: false, Reason: "default"},
+		},
+		{
+			name:   "stream broken off after tokens is refunded",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusOK, TokensProduced: true},
+			want:   middleware.RefundDecision{Refund: true, Reason: "incomplete_response"},
+		},
+		{
+			name:   "stream broken off is charged when incomplete streams are not refunded",
+			policy: keepIncomplete,
+			in:     middleware.RefundInput{StatusCode: http.StatusOK, TokensProduced: true},
+			want:   middleware.RefundDecision{Refund: false, Reason: "incomplete_response"},
+		},
+		{
+			name:   "client canceled after tokens is charged",
+			policy: defaults,
+			in: middleware.RefundInput{
+				StatusCode:     http.StatusOK,
+				TokensProduced: true,
+				ClientCanceled: true,
+			},
+			want: middleware.RefundDecision{Refund: false, Reason: "tokens_produced"},
+		},
+		{
+			name:   "client canceled before tokens is refunded",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusOK, ClientCanceled: true},
+			want:   middleware.RefundDecision{Refund: true, Reason: "client_canceled"},
+		},
+		{
+			name:   "upstream 5xx is refunded",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusBadGateway, Completed: true},
+			want:   middleware.RefundDecision{Refund: true, Reason: "status_class"},
+		},
+		{
+			name:   "upstream 429 is refunded",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusTooManyRequests, Completed: true},
+			want:   middleware.RefundDecision{Refund: true, Reason: "status_code"},
+		},
+		{
+			name:   "upstream 400 is charged",
+			policy: defaults,
+			in:     middleware.RefundInput{StatusCode: http.StatusBadRequest, Completed: true},
+			want:   middleware.RefundDecision{Refund: false, Reason: "default"},
+		},
+		{
+			name:   "refunded error type wins over produced tokens",
+			policy: withErrorTypes,
+			in: middleware.RefundInput{
+				StatusCode:     http.StatusOK,
+				ErrorType:      "server_error",
+				TokensProduced: true,
+				Completed:      true,
+			},
+			want: middleware.RefundDecision{Refund: true, Reason: "error_type"},
+		},
+		{
+			name:   "charged error type wins over status class",
+			policy: withErrorTypes,
+			in: middleware.RefundInput{
+				StatusCode: http.StatusInternalServerError,
+				ErrorType:  "invalid_request_error",
+				Completed:  true,
+			},
+			want: middleware.RefundDecision{Refund: false, Reason: "error_type"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := middleware.DecideRefund(tt.policy, tt.in); got != tt.want {
+				t.Errorf("middleware.DecideRefund() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/utils/lru"
+	"golang.org/x/sync/singleflight"
+)
+
+const keyValidationTimeout = 30 * time.Second
+
+// keyValidationGroup 合并同一个key的并发解析
+var keyValidationGroup singleflight.Group
+
+// rejectedKeyCache 记住被明确拒绝的key hash，避免暴力尝试放大到上游
+var rejectedKeyCache = sync.OnceValue(func() *lru.Cache[string, struct{}] {
+	return lru.New[string, struct{}](
+		int(config.RejectedKeyCacheSize),
+		config.RejectedKeyCacheTTL,
+	)
+})
+
+func isKeyRejected(keyHash string) bool {
+	_, ok := rejectedKeyCache().Get(keyHash)
+	return ok
+}
+
+func rejectKey(keyHash string) {
+	rejectedKeyCache().Add(keyHash, struct{}{})
+}
+
+// RejectedKeyCacheStats 返回被拒绝key缓存的命中统计
+func RejectedKeyCacheStats() lru.Stats {
+	return rejectedKeyCache().Stats()
+}
@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/db"
+)
+
+const (
+	RequestIDKey    = "request_id"
+	RequestIDHeader = "X-Request-Id"
+)
+
+type requestIDContextKey struct{}
+
+// requestIDPattern limits the ids accepted from clients so they are safe to
+// log and store
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestIDMiddleware assigns every request an id, a well formed id sent by the
+// client or a proxy in front of us is kept so logs can be correlated
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, id)
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// AuditFromContext describes the admin or system actor of the current request
+// for the audit log
+func AuditFromContext(c *gin.Context) db.Audit {
+	actor := c.GetString(AdminActorKey)
+	if actor == "" {
+		actor = db.SystemAudit.Actor
+	}
+
+	return db.Audit{Actor: actor, RequestID: c.GetString(RequestIDKey)}
+}
+
+// resolverAudit describes a change made by a namespace resolver
+func resolverAudit(ctx context.Context, name string) db.Audit {
+	return db.Audit{Actor: "resolver:" + name, RequestID: requestIDFromContext(ctx)}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/module"
+	"github.com/labring/aiproxy-free/server/resolver"
+	log "github.com/sirupsen/logrus"
+)
+
+const revalidateTimeout = 30 * time.Second
+
+// revalidating 记录本副本正在后台重新校验的key，避免同一个key并发重复校验
+var revalidating sync.Map
+
+// revalidateIfStale 超过KeyRevalidateInterval的映射在后台重新校验，
+// 超过KeyRevalidateHardExpiry的映射需要等待校验完成后才能继续请求
+func revalidateIfStale(
+	ctx context.Context,
+	key string,
+	mapping *module.KeyMapping,
+) (string, error) {
+	// 本地签发的key只存在于数据库中，不需要重新校验
+	if mapping.Source == module.KeyMappingSourceLocal {
+		return mapping.Namespace, nil
+	}
+
+	age := time.Since(mapping.LastValidatedAt)
+
+	if config.KeyRevalidateHardExpiry > 0 && age > config.KeyRevalidateHardExpiry {
+		namespace, err := revalidateKey(ctx, key, mapping)
+		if err != nil && !errors.Is(err, resolver.ErrUnauthorized) {
+			// 上游暂时不可用时继续使用旧的映射
+			log.Errorf("Failed to revalidate expired key mapping: %v", err)
+			return mapping.Namespace, nil
+		}
+
+		return namespace, err
+	}
+
+	if config.KeyRevalidateInterval > 0 && age > config.KeyRevalidateInterval {
+		if _, loaded := revalidating.LoadOrStore(mapping.KeyHash, struct{}{}); !loaded {
+			go func() {
+				defer revalidating.Delete(mapping.KeyHash)
+
+				ctx, cancel := context.WithTimeout(
+					withRequestID(context.Background(), requestIDFromContext(ctx)),
+					revalidateTimeout,
+				)
+				defer cancel()
+
+				if _, err := revalidateKey(ctx, key, mapping); err != nil &&
+					!errors.Is(err, resolver.ErrUnauthorized) {
+					log.Errorf("Failed to revalidate stale key mapping: %v", err)
+				}
+			}()
+		}
+	}
+
+	return mapping.Namespace, nil
+}
+
+// revalidateKey 使用创建映射的resolver重新解析key，被拒绝的key删除映射，namespace变化的key更新映射，
+// 管理员固定的映射只确认key仍然有效，保留管理员指定的namespace
+func revalidateKey(ctx context.Context, key string, mapping *module.KeyMapping) (string, error) {
+	r, ok := resolver.Default().Get(mapping.Source)
+	if !ok {
+		// 创建映射的resolver已经不再启用，继续信任已有映射
+		return mapping.Namespace, nil
+	}
+
+	result, err := r.Resolve(ctx, key)
+	if errors.Is(err, resolver.ErrUnauthorized) || errors.Is(err, resolver.ErrNotHandled) {
+		log.Infof(
+			"Key %s of namespace %s was revoked by %s, deleting its mapping",
+			mapping.KeyPrefix,
+			mapping.Namespace,
+			mapping.Source,
+		)
+
+		rejectKey(mapping.KeyHash)
+
+		if err := db.DeleteMapping(resolverAudit(ctx, mapping.Source), mapping.KeyHash); err != nil {
+			return "", fmt.Errorf("failed to delete revoked key mapping: %w", err)
+		}
+
+		return "", resolver.ErrUnauthorized
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if mapping.Pinned {
+		if err := db.TouchMappingValidated(mapping.KeyHash); err != nil {
+			return "", err
+		}
+
+		return mapping.Namespace, nil
+	}
+
+	// 与Chain.Resolve一致，空namespace视为resolver出错，不能把key移到空namespace
+	if result.Namespace == "" {
+		return "", fmt.Errorf("resolver %s returned an empty namespace", r.Name())
+	}
+
+	if result.Namespace != mapping.Namespace {
+		log.Infof(
+			"Key %s moved by %s from namespace %s to %s",
+			mapping.KeyPrefix,
+			mapping.Source,
+			mapping.Namespace,
+			result.Namespace,
+		)
+
+		if err := db.UpdateMapping(
+			resolverAudit(ctx, mapping.Source),
+			mapping.KeyHash,
+			result.Namespace,
+			false,
+		); err != nil {
+			return "", fmt.Errorf("failed to update moved key mapping: %w", err)
+		}
+	}
+
+	if err := db.TouchMappingValidated(mapping.KeyHash); err != nil {
+		return "", err
+	}
+
+	return result.Namespace, nil
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkShadowRateLimit evaluates config.ShadowLimitPolicy against the same
+// usage as the enforced policy, differing decisions are counted per namespace
+// and day in the database so every replica adds to the same totals
+func checkShadowRateLimit(usage *namespaceUsage, enforcedAllowed bool) {
+	policy := config.ShadowLimitPolicy
+	if policy == nil {
+		return
+	}
+
+	message, allowed, err := checkRateLimit(*policy, usage)
+	if err != nil {
+		log.Errorf("Failed to check shadow rate limit: %v", err)
+		return
+	}
+
+	if allowed == enforcedAllowed {
+		return
+	}
+
+	if err := db.IncrShadowDecision(time.Now(), usage.namespace, allowed); err != nil {
+		log.Errorf("Failed to count shadow decision: %v", err)
+	}
+
+	if allowed {
+		log.Debugf("Shadow policy would allow request of namespace %s", usage.namespace)
+	} else {
+		log.Debugf(
+			"Shadow policy would reject request of namespace %s: %s",
+			usage.namespace,
+			message,
+		)
+	}
+}
@@ -0,0 +1,69 @@
+package module
+
+// CreateCreditGrantRequest 创建奖励额度请求
+type CreateCreditGrantRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	Amount    int64  `json:"amount" binding:"required,gt=0"`
+	Reason    string `json:"reason"`
+	StartsAt  int64  `json:"starts_at"`                     // 毫秒时间戳，默认为当前时间
+	ExpiresAt int64  `json:"expires_at" binding:"required"` // 毫秒时间戳
+}
+
+// CreateLocalKeyRequest 签发本地key请求
+type CreateLocalKeyRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+}
+
+// CreateLocalKeyResponse 签发本地key响应，明文key只会返回这一次
+type CreateLocalKeyResponse struct {
+	Key       string `json:"key"`
+	KeyHash   string `json:"key_hash"`
+	KeyPrefix string `json:"key_prefix"`
+	Namespace string `json:"namespace"`
+	CreatedAt int64  `json:"created_at"` // 毫秒时间戳
+}
+
+// CreateBanRequest 创建封禁请求
+type CreateBanRequest struct {
+	TargetType string `json:"target_type" binding:"required,oneof=key namespace ip"`
+	// Target 为key、namespace、IP或者CIDR，key类型默认传入明文key
+	Target string `json:"target" binding:"required"`
+	// Hashed 表示key类型的Target已经是key的哈希
+	Hashed    bool   `json:"hashed"`
+	Reason    string `json:"reason"`
+	ExpiresAt int64  `json:"expires_at"` // 毫秒时间戳，为空表示永久封禁
+}
+
+// UpdateMappingRequest 修改key映射请求
+type UpdateMappingRequest struct {
+	Namespace string `json:"namespace" binding:"required"`
+	// Pinned 默认为true，重新校验时保留这个namespace；为false时交还给resolver管理
+	Pinned *bool `json:"pinned"`
+}
+
+// ResetQuotaRequest 重置额度请求
+type ResetQuotaRequest struct {
+	Window string `json:"window" binding:"omitempty,oneof=day month"` // 默认为day
+	Reason string `json:"reason"`
+}
+
+// AdjustQuotaRequest 调整已用额度请求，Delta为正数增加已用次数，为负数扣减已用次数
+type AdjustQuotaRequest struct {
+	Delta  int64  `json:"delta" binding:"required,ne=0,min=-10000,max=10000"`
+	Window string `json:"window" binding:"omitempty,oneof=day month"` // 扣减的窗口，默认为day
+	Reason string `json:"reason"`
+}
+
+// AdminLoginRequest 管理后台登录请求
+type AdminLoginRequest struct {
+	Token string `json:"token" binding:"required"`
+	Actor string `json:"actor"` // 写入审计记录的操作人，默认为admin
+}
+
+// UpdatePlanRequest 修改默认计划请求，保存后代替环境变量中配置的限额
+type UpdatePlanRequest struct {
+	DailyRequestLimit   int64 `json:"daily_request_limit" binding:"required,gt=0"`
+	MonthlyRequestLimit int64 `json:"monthly_request_limit" binding:"gte=0"` // 为0表示不限制
+	// MonthlyLimitMode 为calendar或者rolling，默认为calendar
+	MonthlyLimitMode string `json:"monthly_limit_mode" binding:"omitempty,oneof=calendar rolling"`
+}
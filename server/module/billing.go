@@ -0,0 +1,38 @@
+package module
+
+// BillingSubscriptionResponse 兼容OpenAI /v1/dashboard/billing/subscription 的响应，
+// 额度按单价换算成美元
+type BillingSubscriptionResponse struct {
+	Object             string      `json:"object"`
+	HasPaymentMethod   bool        `json:"has_payment_method"`
+	SoftLimitUSD       float64     `json:"soft_limit_usd"`
+	HardLimitUSD       float64     `json:"hard_limit_usd"`
+	SystemHardLimitUSD float64     `json:"system_hard_limit_usd"`
+	AccessUntil        int64       `json:"access_until"` // 秒级时间戳，为当前额度的重置时间
+	Plan               BillingPlan `json:"plan"`
+}
+
+// BillingPlan 订阅计划
+type BillingPlan struct {
+	Title string `json:"title"`
+	ID    string `json:"id"`
+}
+
+// BillingUsageResponse 兼容OpenAI /v1/dashboard/billing/usage 的响应
+type BillingUsageResponse struct {
+	Object     string             `json:"object"`
+	TotalUsage float64            `json:"total_usage"` // 美分
+	DailyCosts []BillingDailyCost `json:"daily_costs"`
+}
+
+// BillingDailyCost 某一天的消耗
+type BillingDailyCost struct {
+	Timestamp float64           `json:"timestamp"` // 秒级时间戳
+	LineItems []BillingLineItem `json:"line_items"`
+}
+
+// BillingLineItem 某一天中一个条目的消耗
+type BillingLineItem struct {
+	Name string  `json:"name"`
+	Cost float64 `json:"cost"` // 美分
+}
@@ -57,3 +57,27 @@ func NewAuthenticationError(message string) *OpenAIErrorResponse {
 func NewBadGatewayError(message string) *OpenAIErrorResponse {
 	return NewOpenAIError("upstream_error", message, http.StatusBadGateway)
 }
+
+func NewForbiddenError(message string) *OpenAIErrorResponse {
+	return NewOpenAIError("permission_denied", message, http.StatusForbidden)
+}
+
+func NewNotFoundError(message string) *OpenAIErrorResponse {
+	return NewOpenAIError("not_found", message, http.StatusNotFound)
+}
+
+func NewCapacityExhaustedError(message string) *OpenAIErrorResponse {
+	return NewOpenAIError("capacity_exhausted", message, http.StatusServiceUnavailable)
+}
+
+func NewRequestTooLargeError(message string) *OpenAIErrorResponse {
+	return NewOpenAIError(
+		"request_too_large",
+		message,
+		http.StatusRequestEntityTooLarge,
+	)
+}
+
+func NewAccountSuspendedError(message string) *OpenAIErrorResponse {
+	return NewOpenAIError("account_suspended", message, http.StatusForbidden)
+}
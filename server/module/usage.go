@@ -2,8 +2,46 @@ package module
 
 // UsageResponse API key使用情况查询响应
 type UsageResponse struct {
-	TotalLimit     int64 `json:"total_limit"`     // 总共可以使用多少次
-	UsedToday      int64 `json:"used_today"`      // 过去一天内使用了多少次
-	RemainingToday int64 `json:"remaining_today"` // 今天还能使用多少次
-	NextResetTime  int64 `json:"next_reset_time"` // 下一次重置时间
+	TotalLimit         int64              `json:"total_limit"`          // 总共可以使用多少次
+	UsedToday          int64              `json:"used_today"`           // 过去一天内使用了多少次
+	RemainingToday     int64              `json:"remaining_today"`      // 今天还能使用多少次
+	NextResetTime      int64              `json:"next_reset_time"`      // 下一次重置时间
+	MonthlyLimit       int64              `json:"monthly_limit"`        // 每月总共可以使用多少次，为0时不限制
+	UsedThisMonth      int64              `json:"used_this_month"`      // 当前月度窗口内使用了多少次
+	RemainingThisMonth int64              `json:"remaining_this_month"` // 当前月度窗口内还能使用多少次
+	MonthlyResetTime   int64              `json:"monthly_reset_time"`   // 下一次月度重置时间
+	BonusRemaining     int64              `json:"bonus_remaining"`      // 奖励额度剩余次数
+	Grants             []CreditGrantUsage `json:"grants"`               // 当前有效的奖励额度
+}
+
+// CreditGrantUsage 奖励额度使用情况
+type CreditGrantUsage struct {
+	Amount    int64  `json:"amount"`
+	Used      int64  `json:"used"`
+	Remaining int64  `json:"remaining"`
+	Reason    string `json:"reason"`
+	StartsAt  int64  `json:"starts_at"`  // 毫秒时间戳
+	ExpiresAt int64  `json:"expires_at"` // 毫秒时间戳
+}
+
+// UsageHistoryResponse 最近若干天的用量历史
+type UsageHistoryResponse struct {
+	Days   []DailyUsage `json:"days"`   // 按日期升序，没有请求的日期也会返回
+	Models []ModelUsage `json:"models"` // 整个区间内按模型统计，按请求数降序
+}
+
+// DailyUsage 某一天的请求统计
+type DailyUsage struct {
+	Date     string `json:"date"` // 本地时区的日期，格式为2006-01-02
+	Requests int64  `json:"requests"`
+	Refunded int64  `json:"refunded"`
+	Rejected int64  `json:"rejected"`
+}
+
+// ModelUsage 某个模型的请求统计
+type ModelUsage struct {
+	Model    string `json:"model"`
+	Requests int64  `json:"requests"`
+	Refunded int64  `json:"refunded"`
+	Rejected int64  `json:"rejected"`
 }
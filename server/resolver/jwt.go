@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/jwt"
+)
+
+const JWTName = "jwt"
+
+// JWTConfig configures the jwt resolver, at least one of Secret and JWKS must
+// be set
+type JWTConfig struct {
+	// Secret verifies HS256 tokens
+	Secret string
+	// JWKS is a local file or URL holding the RS256 / ES256 verification keys
+	JWKS         string
+	JWKSCacheTTL time.Duration
+	Issuer       string
+	Audience     string
+	Leeway       time.Duration
+	// Claim holds the namespace
+	Claim string
+}
+
+// JWT resolves signed tokens, the namespace is read from a configurable claim,
+// keys that are not JWTs are left to the next resolver
+type JWT struct {
+	verifier *jwt.Verifier
+	claim    string
+}
+
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	if cfg.Secret == "" && cfg.JWKS == "" {
+		return nil, errors.New("neither jwt secret nor jwks is configured")
+	}
+
+	if cfg.Claim == "" {
+		return nil, errors.New("jwt namespace claim is not configured")
+	}
+
+	opts := []jwt.VerifierOption{
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+
+	if cfg.Secret != "" {
+		opts = append(opts, jwt.WithHMACSecret([]byte(cfg.Secret)))
+	}
+
+	if cfg.JWKS != "" {
+		opts = append(opts, jwt.WithKeySet(jwt.NewJWKS(cfg.JWKS, cfg.JWKSCacheTTL)))
+	}
+
+	return &JWT{verifier: jwt.NewVerifier(opts...), claim: cfg.Claim}, nil
+}
+
+func (j *JWT) Name() string {
+	return JWTName
+}
+
+func (j *JWT) Resolve(ctx context.Context, key string) (Result, error) {
+	if !jwt.LooksLikeJWT(key) {
+		return Result{}, ErrNotHandled
+	}
+
+	claims, err := j.verifier.Verify(ctx, key)
+	if err != nil {
+		// jwks暂时无法获取不能当作token无效
+		if !isTokenError(err) {
+			return Result{}, fmt.Errorf("failed to verify token: %w", err)
+		}
+
+		return Result{}, fmt.Errorf("%w: %w", ErrUnauthorized, err)
+	}
+
+	namespace := claims.String(j.claim)
+	if namespace == "" {
+		return Result{}, fmt.Errorf("%w: missing %s claim", ErrUnauthorized, j.claim)
+	}
+
+	// token本身携带namespace，不需要保存映射
+	return Result{Namespace: namespace, Persist: false}, nil
+}
+
+func isTokenError(err error) bool {
+	for _, target := range []error{
+		jwt.ErrMalformed,
+		jwt.ErrUnsupportedAlg,
+		jwt.ErrInvalidSignature,
+		jwt.ErrExpired,
+		jwt.ErrNotYetValid,
+		jwt.ErrInvalidIssuer,
+		jwt.ErrInvalidAudience,
+		jwt.ErrKeyNotFound,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
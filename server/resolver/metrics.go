@@ -0,0 +1,41 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/metrics"
+)
+
+// instrumented records the result and latency of every call to a resolver
+type instrumented struct {
+	NamespaceResolver
+}
+
+func instrument(r NamespaceResolver) NamespaceResolver {
+	return &instrumented{NamespaceResolver: r}
+}
+
+func (i *instrumented) Resolve(ctx context.Context, key string) (Result, error) {
+	start := time.Now()
+	result, err := i.NamespaceResolver.Resolve(ctx, key)
+	metrics.KeyValidationDuration.WithLabelValues(i.Name()).Observe(metrics.Since(start))
+
+	var label string
+
+	switch {
+	case err == nil:
+		label = "valid"
+	case errors.Is(err, ErrNotHandled):
+		label = "not_handled"
+	case errors.Is(err, ErrUnauthorized):
+		label = "unauthorized"
+	default:
+		label = "error"
+	}
+
+	metrics.KeyValidations.WithLabelValues(i.Name(), label).Inc()
+
+	return result, err
+}
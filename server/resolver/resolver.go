@@ -0,0 +1,154 @@
+// Package resolver discovers which namespace an api key belongs to.
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/utils/jwt"
+)
+
+var (
+	// ErrNotHandled is returned when a resolver does not recognize the key, the
+	// chain then moves on to the next resolver
+	ErrNotHandled = errors.New("key not handled by resolver")
+	// ErrUnauthorized is returned when a resolver recognizes the key and
+	// definitively rejects it
+	ErrUnauthorized = errors.New("key not authorized")
+)
+
+// Result is a successful resolution
+type Result struct {
+	Namespace string
+	// Persist saves the key mapping so later requests skip the resolver until
+	// the mapping is revalidated
+	Persist bool
+}
+
+// NamespaceResolver resolves the namespace of an api key. Transient failures
+// are returned as errors other than ErrNotHandled and ErrUnauthorized.
+type NamespaceResolver interface {
+	// Name identifies the resolver in config and is stored as the source of
+	// persisted key mappings
+	Name() string
+	Resolve(ctx context.Context, key string) (Result, error)
+}
+
+// Chain tries its resolvers in order until one handles the key
+type Chain []NamespaceResolver
+
+// Resolve returns the result of the first resolver that handles the key along
+// with that resolver, ErrUnauthorized is returned when no resolver handles it
+func (c Chain) Resolve(ctx context.Context, key string) (Result, NamespaceResolver, error) {
+	for _, r := range c {
+		result, err := r.Resolve(ctx, key)
+		if errors.Is(err, ErrNotHandled) {
+			continue
+		}
+
+		if err != nil {
+			return Result{}, r, err
+		}
+
+		if result.Namespace == "" {
+			return Result{}, r, fmt.Errorf("resolver %s returned an empty namespace", r.Name())
+		}
+
+		return result, r, nil
+	}
+
+	return Result{}, nil, ErrUnauthorized
+}
+
+// Get returns the resolver with the given name
+func (c Chain) Get(name string) (NamespaceResolver, bool) {
+	for _, r := range c {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+
+	return nil, false
+}
+
+var defaultChain Chain
+
+// Default returns the chain built by InitFromConfig, or only the upstream
+// resolver when it has not been called
+func Default() Chain {
+	if defaultChain == nil {
+		return Chain{instrument(NewUpstream(config.UpstreamBaseURL))}
+	}
+
+	return defaultChain
+}
+
+// InitFromConfig builds the default chain from config.NamespaceResolvers
+func InitFromConfig() error {
+	chain := make(Chain, 0, len(config.NamespaceResolvers))
+
+	for _, name := range config.NamespaceResolvers {
+		r, err := newResolver(strings.ToLower(name))
+		if err != nil {
+			return fmt.Errorf("failed to create namespace resolver %s: %w", name, err)
+		}
+
+		chain = append(chain, instrument(r))
+	}
+
+	if len(chain) == 0 {
+		return errors.New("no namespace resolver configured")
+	}
+
+	defaultChain = chain
+
+	return nil
+}
+
+func newResolver(name string) (NamespaceResolver, error) {
+	switch name {
+	case UpstreamName:
+		return NewUpstream(config.UpstreamBaseURL), nil
+	case StaticName:
+		return NewStaticFromFile(config.StaticKeysFile)
+	case WebhookName:
+		return NewWebhook(config.NamespaceWebhookURL, config.NamespaceWebhookTimeout)
+	case JWTName:
+		return newJWTFromConfig()
+	default:
+		return nil, errors.New("unknown resolver")
+	}
+}
+
+func newJWTFromConfig() (*JWT, error) {
+	jwks := config.JWTJWKS
+	if jwks == "" && config.JWTOIDCDiscovery {
+		if config.JWTIssuer == "" {
+			return nil, errors.New("oidc discovery requires a jwt issuer")
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var err error
+
+		jwks, err = jwt.DiscoverJWKSURL(ctx, config.JWTIssuer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return NewJWT(JWTConfig{
+		Secret:       config.JWTSecret,
+		JWKS:         jwks,
+		JWKSCacheTTL: config.JWTJWKSCacheTTL,
+		Issuer:       config.JWTIssuer,
+		Audience:     config.JWTAudience,
+		Leeway:       config.JWTLeeway,
+		Claim:        config.JWTNamespaceClaim,
+	})
+}
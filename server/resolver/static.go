@@ -0,0 +1,54 @@
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bytedance/sonic"
+)
+
+const StaticName = "static"
+
+// Static resolves keys from a fixed key to namespace map, keys missing from the
+// map are left to the next resolver
+type Static struct {
+	namespaces map[string]string
+}
+
+func NewStatic(namespaces map[string]string) *Static {
+	return &Static{namespaces: namespaces}
+}
+
+// NewStaticFromFile loads a JSON object of key to namespace from path
+func NewStaticFromFile(path string) (*Static, error) {
+	if path == "" {
+		return nil, fmt.Errorf("static keys file is not configured")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces map[string]string
+	if err := sonic.Unmarshal(data, &namespaces); err != nil {
+		return nil, fmt.Errorf("failed to parse static keys file %s: %w", path, err)
+	}
+
+	return NewStatic(namespaces), nil
+}
+
+func (s *Static) Name() string {
+	return StaticName
+}
+
+func (s *Static) Resolve(_ context.Context, key string) (Result, error) {
+	namespace, ok := s.namespaces[key]
+	if !ok {
+		return Result{}, ErrNotHandled
+	}
+
+	// 文件本身就是映射的来源，不需要保存到数据库
+	return Result{Namespace: namespace, Persist: false}, nil
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+const UpstreamName = "upstream"
+
+// Upstream resolves keys through the upstream /v1/models endpoint, the
+// namespace is the Group response header
+type Upstream struct {
+	baseURL string
+}
+
+func NewUpstream(baseURL string) *Upstream {
+	return &Upstream{baseURL: baseURL}
+}
+
+func (u *Upstream) Name() string {
+	return UpstreamName
+}
+
+func (u *Upstream) Resolve(ctx context.Context, key string) (Result, error) {
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		u.baseURL+"/v1/models",
+		nil,
+	)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create permission check request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to check API key permission: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// 只有上游明确拒绝时才认为key无效，限流和服务端错误是临时失败
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode >= http.StatusInternalServerError:
+		return Result{}, fmt.Errorf("upstream returned status %d", resp.StatusCode)
+	default:
+		return Result{}, ErrUnauthorized
+	}
+
+	namespace := resp.Header.Get("Group")
+	if namespace == "" {
+		return Result{}, errors.New("upstream implementation is incorrect: missing Group header")
+	}
+
+	return Result{Namespace: namespace, Persist: true}, nil
+}
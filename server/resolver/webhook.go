@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+const WebhookName = "webhook"
+
+const maxWebhookResponseSize = 64 * 1024
+
+// Webhook resolves keys by POSTing {"key": "..."} to an HTTP endpoint which
+// answers 200 with {"namespace": "..."}, 401/403 to reject the key and 404 to
+// leave it to the next resolver
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhook(url string, timeout time.Duration) (*Webhook, error) {
+	if url == "" {
+		return nil, errors.New("namespace webhook url is not configured")
+	}
+
+	return &Webhook{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (w *Webhook) Name() string {
+	return WebhookName
+}
+
+type webhookRequest struct {
+	Key string `json:"key"`
+}
+
+type webhookResponse struct {
+	Namespace string `json:"namespace"`
+}
+
+func (w *Webhook) Resolve(ctx context.Context, key string) (Result, error) {
+	body, err := sonic.Marshal(&webhookRequest{Key: key})
+	if err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create namespace webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to call namespace webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return Result{}, ErrUnauthorized
+	case http.StatusNotFound:
+		return Result{}, ErrNotHandled
+	default:
+		return Result{}, fmt.Errorf("namespace webhook returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseSize))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read namespace webhook response: %w", err)
+	}
+
+	var result webhookResponse
+	if err := sonic.Unmarshal(data, &result); err != nil {
+		return Result{}, fmt.Errorf("failed to parse namespace webhook response: %w", err)
+	}
+
+	if result.Namespace == "" {
+		return Result{}, errors.New("namespace webhook returned an empty namespace")
+	}
+
+	return Result{Namespace: result.Namespace, Persist: true}, nil
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy-free/server/dashboard"
 	"github.com/labring/aiproxy-free/server/handler"
 	"github.com/labring/aiproxy-free/server/middleware"
 )
@@ -13,15 +14,85 @@ func SetRouter(router *gin.Engine) {
 	}
 
 	v1 := router.Group("/v1")
+	v1.Use(middleware.IPBanMiddleware())
+	v1.Use(middleware.IPBurstLimitMiddleware())
+	v1.Use(middleware.IPDailyLimitMiddleware())
 	v1.Use(middleware.AuthMiddleware())
 	v1.Use(middleware.RateLimitMiddleware())
 	{
 		v1.POST("/chat/completions", handler.ChatCompletionsHandler)
 	}
 
+	// 余额查询不经过限流，否则客户端刷新余额也会消耗额度
+	billing := router.Group("/v1/dashboard/billing")
+	billing.Use(middleware.IPBanMiddleware())
+	billing.Use(middleware.IPBurstLimitMiddleware())
+	billing.Use(middleware.AuthMiddleware())
+	{
+		billing.GET("/subscription", handler.BillingSubscriptionHandler)
+		billing.GET("/usage", handler.BillingUsageHandler)
+	}
+
 	usage := router.Group("/usage")
+	usage.Use(middleware.IPBanMiddleware())
+	usage.Use(middleware.IPBurstLimitMiddleware())
 	usage.Use(middleware.AuthMiddleware())
 	{
 		usage.GET("", handler.UsageHandler)
+		usage.GET("/history", handler.UsageHistoryHandler)
+	}
+
+	// 登录接口和页面本身不需要管理员认证
+	session := router.Group("/admin/session")
+	session.Use(middleware.IPBurstLimitMiddleware())
+	{
+		session.POST("", handler.AdminLoginHandler)
+		session.DELETE("", handler.AdminLogoutHandler)
+	}
+
+	router.GET(dashboard.BasePath+"/*filepath", dashboard.Handler())
+
+	admin := router.Group("/admin")
+	admin.Use(middleware.AdminAuthMiddleware())
+	{
+		admin.GET("/grants", handler.ListCreditGrantsHandler)
+		admin.POST("/grants", handler.CreateCreditGrantHandler)
+		admin.DELETE("/grants/:id", handler.DeleteCreditGrantHandler)
+
+		admin.GET("/local-keys", handler.ListLocalKeysHandler)
+		admin.POST("/local-keys", handler.CreateLocalKeyHandler)
+		admin.DELETE("/local-keys/:key_hash", handler.RevokeLocalKeyHandler)
+
+		admin.GET("/mappings", handler.ListMappingsHandler)
+		admin.GET("/mappings/:key_hash", handler.GetMappingHandler)
+		admin.PUT("/mappings/:key_hash", handler.UpdateMappingHandler)
+		admin.DELETE("/mappings/:key_hash", handler.DeleteMappingHandler)
+		admin.GET("/namespaces/:namespace/keys", handler.ListNamespaceKeysHandler)
+		admin.GET("/namespaces/:namespace/quota/records", handler.ListCountedRequestsHandler)
+		admin.POST("/namespaces/:namespace/quota/reset", handler.ResetQuotaHandler)
+		admin.POST("/namespaces/:namespace/quota/adjust", handler.AdjustQuotaHandler)
+		admin.GET(
+			"/namespaces/:namespace/quota/adjustments",
+			handler.ListQuotaAdjustmentsHandler,
+		)
+
+		admin.GET("/bans", handler.ListBansHandler)
+		admin.POST("/bans", handler.CreateBanHandler)
+		admin.DELETE("/bans/:id", handler.DeleteBanHandler)
+
+		admin.GET("/analytics/top-namespaces", handler.TopNamespacesHandler)
+		admin.GET("/analytics/series", handler.UsageSeriesHandler)
+		admin.GET("/analytics/summary", handler.UsageSummaryHandler)
+
+		admin.GET("/audit", handler.ListAuditEventsHandler)
+
+		admin.GET("/whoami", handler.AdminWhoAmIHandler)
+		admin.GET("/limits", handler.LimitsHandler)
+		admin.GET("/plan", handler.GetPlanHandler)
+		admin.PUT("/plan", handler.UpdatePlanHandler)
+		admin.DELETE("/plan", handler.DeletePlanHandler)
+
+		admin.GET("/shadow", handler.ShadowStatsHandler)
+		admin.GET("/cache", handler.CacheStatsHandler)
 	}
 }
@@ -0,0 +1,199 @@
+// Package webhook delivers the events queued in the webhook outbox table to the
+// configured endpoints, retrying failed deliveries with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labring/aiproxy-free/config"
+	"github.com/labring/aiproxy-free/db"
+	"github.com/labring/aiproxy-free/module"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-Id"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+
+	pollInterval = 5 * time.Second
+	claimBatch   = 20
+	// claimLeaseMargin 在一批投递的最长耗时之外留出的余量
+	claimLeaseMargin = time.Minute
+	baseBackoff      = 30 * time.Second
+	maxBackoff       = time.Hour
+	// maxErrorLength 限制保存的响应内容长度
+	maxErrorLength = 512
+)
+
+// Start delivers due webhooks until ctx is done, it returns immediately when no
+// endpoint is configured
+func Start(ctx context.Context) {
+	if len(config.WebhookEndpoints) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			deliverDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// deliverDue 一直领取并投递到期的webhook，直到没有到期的投递
+func deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := db.ClaimDueWebhooks(claimBatch, claimLease())
+		if err != nil {
+			log.Errorf("Failed to claim webhook deliveries: %v", err)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			deliver(ctx, delivery)
+		}
+
+		if len(deliveries) < claimBatch {
+			return
+		}
+	}
+}
+
+// claimLease 一批投递串行发送，每个最多等待WebhookTimeout，租约必须覆盖整批投递，
+// 否则后面的投递在发送之前就可能被其他副本重复领取
+func claimLease() time.Duration {
+	return claimBatch*config.WebhookTimeout + claimLeaseMargin
+}
+
+func deliver(ctx context.Context, delivery module.WebhookDelivery) {
+	endpoint, ok := config.FindWebhookEndpoint(delivery.Endpoint)
+	if !ok {
+		markFailed(delivery, "endpoint is no longer configured", time.Time{})
+		return
+	}
+
+	err := post(ctx, endpoint, delivery)
+	if err == nil {
+		if err := db.MarkWebhookDelivered(delivery.ID); err != nil {
+			log.Errorf("Failed to mark webhook delivered: %v", err)
+		}
+
+		return
+	}
+
+	var next time.Time
+	if delivery.Attempts < config.WebhookMaxAttempts {
+		next = time.Now().Add(backoff(delivery.Attempts))
+	}
+
+	markFailed(delivery, err.Error(), next)
+}
+
+func markFailed(delivery module.WebhookDelivery, reason string, next time.Time) {
+	if next.IsZero() {
+		log.Errorf(
+			"Giving up webhook %s %s to %s after %d attempts: %s",
+			delivery.Event,
+			delivery.DedupeKey,
+			delivery.Endpoint,
+			delivery.Attempts,
+			reason,
+		)
+	} else {
+		log.Warnf(
+			"Webhook %s %s to %s failed (attempt %d), retrying at %s: %s",
+			delivery.Event,
+			delivery.DedupeKey,
+			delivery.Endpoint,
+			delivery.Attempts,
+			next.Format(time.RFC3339),
+			reason,
+		)
+	}
+
+	if err := db.MarkWebhookFailed(delivery.ID, reason, next); err != nil {
+		log.Errorf("Failed to mark webhook failed: %v", err)
+	}
+}
+
+// backoff 第n次尝试失败后等待的时间，从baseBackoff开始翻倍，最多maxBackoff
+func backoff(attempts int64) time.Duration {
+	d := baseBackoff
+	for i := int64(1); i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, maxBackoff)
+}
+
+func post(
+	ctx context.Context,
+	endpoint config.WebhookEndpoint,
+	delivery module.WebhookDelivery,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, config.WebhookTimeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		endpoint.URL,
+		bytes.NewReader(body),
+	)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(IDHeader, delivery.DedupeKey)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorLength))
+		return fmt.Errorf("unexpected status code: %d: %s", resp.StatusCode, data)
+	}
+
+	return nil
+}
+
+// Sign returns the signature header value of a payload, the receiver recomputes
+// HMAC-SHA256(secret, timestamp + "." + body) and compares it in constant time
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"net/netip"
+)
+
+// IPLimitKey returns the bucket used to rate limit a client IP, IPv4 addresses
+// are used as-is while IPv6 addresses are aggregated into their prefix, since a
+// single IPv6 client usually owns at least a whole /64
+func IPLimitKey(ip string, ipv6PrefixLength int) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	addr = addr.Unmap().WithZone("")
+	if addr.Is4() || ipv6PrefixLength <= 0 || ipv6PrefixLength >= 128 {
+		return addr.String()
+	}
+
+	prefix, err := addr.Prefix(ipv6PrefixLength)
+	if err != nil {
+		return addr.String()
+	}
+
+	return prefix.String()
+}
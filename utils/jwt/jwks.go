@@ -0,0 +1,290 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"golang.org/x/sync/singleflight"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// minRefreshInterval limits how often an unknown kid triggers a refetch, so
+// tokens with random key ids cannot hammer the JWKS endpoint
+const minRefreshInterval = time.Minute
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// JWKS is a KeySet loaded from a local file or an http(s) URL. The keys are
+// cached for ttl and refetched early when a token names an unknown key id.
+type JWKS struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+
+	// group merges concurrent refreshes, the fetch runs without holding mu so
+	// a slow endpoint does not block lookups of cached keys
+	group singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+func NewJWKS(source string, ttl time.Duration) *JWKS {
+	return &JWKS{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Key returns the key with the given id, an empty kid matches the only key of
+// a single key set
+func (s *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	keys, fetchedAt := s.snapshot()
+
+	if keys == nil || (s.ttl > 0 && time.Since(fetchedAt) >= s.ttl) {
+		if err := s.refresh(ctx); err != nil && keys == nil {
+			return nil, err
+		}
+
+		keys, fetchedAt = s.snapshot()
+	}
+
+	if key, ok := lookup(keys, kid); ok {
+		return key, nil
+	}
+
+	if time.Since(fetchedAt) < minRefreshInterval {
+		return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+	}
+
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+
+	keys, _ = s.snapshot()
+	if key, ok := lookup(keys, kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrKeyNotFound, kid)
+}
+
+func (s *JWKS) snapshot() (map[string]crypto.PublicKey, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.keys, s.fetchedAt
+}
+
+func lookup(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+
+	key, ok := keys[kid]
+
+	return key, ok
+}
+
+// refresh reloads the key set, the previous keys are kept when it fails. The
+// fetch is shared by concurrent callers and detached from the cancellation of
+// whichever caller started it.
+func (s *JWKS) refresh(ctx context.Context) error {
+	_, err, _ := s.group.Do("refresh", func() (any, error) {
+		s.mu.Lock()
+		s.fetchedAt = time.Now()
+		s.mu.Unlock()
+
+		data, err := s.load(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jwks from %s: %w", s.source, err)
+		}
+
+		keys, err := ParseJWKS(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse jwks from %s: %w", s.source, err)
+		}
+
+		s.mu.Lock()
+		s.keys = keys
+		s.mu.Unlock()
+
+		return nil, nil
+	})
+
+	return err
+}
+
+func (s *JWKS) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		return os.ReadFile(s.source)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// ParseJWKS decodes the RSA and P-256 signing keys of a JSON Web Key Set,
+// other keys are skipped
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set jwkSet
+	if err := sonic.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no usable signing key")
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid rsa exponent")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return nil, errors.New("invalid ec coordinates")
+		}
+
+		// ecdh validates that the point is on the curve
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+
+	return new(big.Int).SetBytes(data), nil
+}
+
+// DiscoverJWKSURL reads the jwks_uri from the OpenID Connect discovery document
+// of issuer
+func DiscoverJWKSURL(ctx context.Context, issuer string) (string, error) {
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	data, err := NewJWKS(url, 0).load(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch openid configuration from %s: %w", url, err)
+	}
+
+	var doc struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := sonic.Unmarshal(data, &doc); err != nil {
+		return "", fmt.Errorf("failed to parse openid configuration from %s: %w", url, err)
+	}
+
+	if doc.JWKSURI == "" {
+		return "", fmt.Errorf("openid configuration from %s has no jwks_uri", url)
+	}
+
+	return doc.JWKSURI, nil
+}
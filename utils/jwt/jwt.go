@@ -0,0 +1,268 @@
+// Package jwt verifies compact JWS tokens and validates their registered claims.
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bytedance/sonic"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("invalid token signature")
+	ErrExpired          = errors.New("token is expired")
+	ErrNotYetValid      = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid token issuer")
+	ErrInvalidAudience  = errors.New("invalid token audience")
+)
+
+// Claims are the decoded token payload
+type Claims map[string]any
+
+// String returns a string claim
+func (c Claims) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+// LooksLikeJWT reports whether s has the shape of a compact JWS
+func LooksLikeJWT(s string) bool {
+	return strings.Count(s, ".") == 2 && strings.HasPrefix(s, "eyJ")
+}
+
+// KeySet looks up the public key a token was signed with by its key id
+type KeySet interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Verifier checks token signatures and claims. HS256 tokens are verified with
+// the shared secret, RS256 and ES256 tokens with the key set, the algorithm of a
+// token must match the type of its key.
+type Verifier struct {
+	secret   []byte
+	keys     KeySet
+	issuer   string
+	audience string
+	leeway   time.Duration
+}
+
+type VerifierOption func(*Verifier)
+
+// WithHMACSecret enables HS256 tokens
+func WithHMACSecret(secret []byte) VerifierOption {
+	return func(v *Verifier) {
+		v.secret = secret
+	}
+}
+
+// WithKeySet enables RS256 and ES256 tokens
+func WithKeySet(keys KeySet) VerifierOption {
+	return func(v *Verifier) {
+		v.keys = keys
+	}
+}
+
+// WithIssuer requires the iss claim to equal issuer
+func WithIssuer(issuer string) VerifierOption {
+	return func(v *Verifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithAudience requires the aud claim to contain audience
+func WithAudience(audience string) VerifierOption {
+	return func(v *Verifier) {
+		v.audience = audience
+	}
+}
+
+// WithLeeway tolerates clock skew when validating exp and nbf
+func WithLeeway(leeway time.Duration) VerifierOption {
+	return func(v *Verifier) {
+		v.leeway = leeway
+	}
+}
+
+func NewVerifier(opts ...VerifierOption) *Verifier {
+	v := &Verifier{}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	return v
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and claims of token and returns its claims
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, err
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := v.verifySignature(ctx, h, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, signed string, sig []byte) error {
+	switch h.Alg {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return fmt.Errorf("%w: %s", ErrUnsupportedAlg, h.Alg)
+		}
+
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	case "RS256", "ES256":
+		if v.keys == nil {
+			return fmt.Errorf("%w: %s", ErrUnsupportedAlg, h.Alg)
+		}
+
+		key, err := v.keys.Key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+
+		digest := sha256.Sum256([]byte(signed))
+
+		return verifyAsymmetric(h.Alg, key, digest[:], sig)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedAlg, h.Alg)
+	}
+}
+
+func verifyAsymmetric(alg string, key crypto.PublicKey, digest, sig []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return fmt.Errorf("%w: %s with rsa key", ErrUnsupportedAlg, alg)
+		}
+
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || k.Curve.Params().BitSize != 256 || len(sig) != 64 {
+			return fmt.Errorf("%w: %s with ec key", ErrUnsupportedAlg, alg)
+		}
+
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+
+		if !ecdsa.Verify(k, digest, r, s) {
+			return ErrInvalidSignature
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown key type %T", ErrUnsupportedAlg, key)
+	}
+}
+
+func (v *Verifier) validateClaims(claims Claims, now time.Time) error {
+	if exp, ok := numericDate(claims, "exp"); ok && !now.Before(exp.Add(v.leeway)) {
+		return ErrExpired
+	}
+
+	if nbf, ok := numericDate(claims, "nbf"); ok && now.Add(v.leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+
+	if v.issuer != "" && claims.String("iss") != v.issuer {
+		return ErrInvalidIssuer
+	}
+
+	if v.audience != "" && !slices.Contains(audiences(claims), v.audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// audiences returns the aud claim, which may be a single string or an array
+func audiences(claims Claims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		values := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				values = append(values, s)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if err := sonic.Unmarshal(data, v); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+func numericDate(claims Claims, name string) (time.Time, bool) {
+	v, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(v), 0), true
+}
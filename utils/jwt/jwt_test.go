@@ -0,0 +1,451 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy-free/utils/jwt"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func mustJSON(t *testing.T, v any) []byte {
+	t.Helper()
+
+	data, err := sonic.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+// signToken builds a compact JWS, key is a []byte secret for HS256 or a
+// private key for RS256 and ES256
+func signToken(t *testing.T, alg, kid string, claims jwt.Claims, key any) string {
+	t.Helper()
+
+	h := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+
+	signed := b64(mustJSON(t, h)) + "." + b64(mustJSON(t, claims))
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		t.Fatalf("unsupported key type %T", key)
+	}
+
+	return signed + "." + b64(sig)
+}
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(pub.N.Bytes()),
+		"e":   b64(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"x":   b64(pub.X.FillBytes(make([]byte, 32))),
+		"y":   b64(pub.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+type testKeys struct {
+	secret   []byte
+	rsa      *rsa.PrivateKey
+	otherRSA *rsa.PrivateKey
+	ec       *ecdsa.PrivateKey
+	otherEC  *ecdsa.PrivateKey
+	jwks     []byte
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	var (
+		keys testKeys
+		err  error
+	)
+
+	keys.secret = []byte("0123456789abcdef0123456789abcdef")
+
+	if keys.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.otherRSA, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.ec, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys.otherEC, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	keys.jwks = mustJSON(t, map[string]any{
+		"keys": []map[string]string{
+			rsaJWK("rsa", &keys.rsa.PublicKey),
+			ecJWK("ec", &keys.ec.PublicKey),
+		},
+	})
+
+	return keys
+}
+
+func TestVerify(t *testing.T) {
+	keys := newTestKeys(t)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keys.jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	jwks := jwt.NewJWKS(path, time.Hour)
+
+	full := jwt.NewVerifier(
+		jwt.WithHMACSecret(keys.secret),
+		jwt.WithKeySet(jwks),
+		jwt.WithIssuer("issuer"),
+		jwt.WithAudience("aiproxy"),
+		jwt.WithLeeway(30*time.Second),
+	)
+	keySetOnly := jwt.NewVerifier(jwt.WithKeySet(jwks))
+
+	now := time.Now()
+	valid := jwt.Claims{
+		"sub": "user",
+		"iss": "issuer",
+		"aud": []any{"other", "aiproxy"},
+		"exp": float64(now.Add(time.Hour).Unix()),
+	}
+
+	with := func(name string, value any) jwt.Claims {
+		c := jwt.Claims{}
+		for k, v := range valid {
+			c[k] = v
+		}
+
+		c[name] = value
+
+		return c
+	}
+
+	// the classic confusion attack signs an HS256 token with the public key as
+	// the hmac secret
+	rsaPublicDER, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		verifier *jwt.Verifier
+		token    string
+		wantErr  error
+	}{
+		{
+			name:     "hs256 valid",
+			verifier: full,
+			token:    signToken(t, "HS256", "", valid, keys.secret),
+		},
+		{
+			name:     "rs256 valid",
+			verifier: full,
+			token:    signToken(t, "RS256", "rsa", valid, keys.rsa),
+		},
+		{
+			name:     "es256 valid",
+			verifier: full,
+			token:    signToken(t, "ES256", "ec", valid, keys.ec),
+		},
+		{
+			name:     "hs256 bad signature",
+			verifier: full,
+			token:    signToken(t, "HS256", "", valid, []byte("another secret")),
+			wantErr:  jwt.ErrInvalidSignature,
+		},
+		{
+			name:     "rs256 bad signature",
+			verifier: full,
+			token:    signToken(t, "RS256", "rsa", valid, keys.otherRSA),
+			wantErr:  jwt.ErrInvalidSignature,
+		},
+		{
+			name:     "es256 bad signature",
+			verifier: full,
+			token:    signToken(t, "ES256", "ec", valid, keys.otherEC),
+			wantErr:  jwt.ErrInvalidSignature,
+		},
+		{
+			name:     "hs256 signed with rsa public key",
+			verifier: keySetOnly,
+			token:    signToken(t, "HS256", "rsa", valid, rsaPublicDER),
+			wantErr:  jwt.ErrUnsupportedAlg,
+		},
+		{
+			name:     "hs256 signed with rsa public key and secret configured",
+			verifier: full,
+			token:    signToken(t, "HS256", "rsa", valid, rsaPublicDER),
+			wantErr:  jwt.ErrInvalidSignature,
+		},
+		{
+			name:     "rs256 header with ec key",
+			verifier: full,
+			token:    signToken(t, "RS256", "ec", valid, keys.rsa),
+			wantErr:  jwt.ErrUnsupportedAlg,
+		},
+		{
+			name:     "es256 header with rsa key",
+			verifier: full,
+			token:    signToken(t, "ES256", "rsa", valid, keys.ec),
+			wantErr:  jwt.ErrUnsupportedAlg,
+		},
+		{
+			name:     "none alg",
+			verifier: full,
+			token:    b64([]byte(`{"alg":"none"}`)) + "." + b64(mustJSON(t, valid)) + ".",
+			wantErr:  jwt.ErrUnsupportedAlg,
+		},
+		{
+			name:     "unknown kid",
+			verifier: full,
+			token:    signToken(t, "RS256", "missing", valid, keys.rsa),
+			wantErr:  jwt.ErrKeyNotFound,
+		},
+		{
+			name:     "empty kid with several keys",
+			verifier: full,
+			token:    signToken(t, "RS256", "", valid, keys.rsa),
+			wantErr:  jwt.ErrKeyNotFound,
+		},
+		{
+			name:     "expired",
+			verifier: full,
+			token: signToken(t, "RS256", "rsa",
+				with("exp", float64(now.Add(-time.Minute).Unix())), keys.rsa),
+			wantErr: jwt.ErrExpired,
+		},
+		{
+			name:     "expired within leeway",
+			verifier: full,
+			token: signToken(t, "RS256", "rsa",
+				with("exp", float64(now.Add(-10*time.Second).Unix())), keys.rsa),
+		},
+		{
+			name:     "not valid yet",
+			verifier: full,
+			token: signToken(t, "ES256", "ec",
+				with("nbf", float64(now.Add(time.Minute).Unix())), keys.ec),
+			wantErr: jwt.ErrNotYetValid,
+		},
+		{
+			name:     "wrong issuer",
+			verifier: full,
+			token:    signToken(t, "HS256", "", with("iss", "someone"), keys.secret),
+			wantErr:  jwt.ErrInvalidIssuer,
+		},
+		{
+			name:     "wrong audience",
+			verifier: full,
+			token:    signToken(t, "HS256", "", with("aud", "other"), keys.secret),
+			wantErr:  jwt.ErrInvalidAudience,
+		},
+		{
+			name:     "malformed",
+			verifier: full,
+			token:    "eyJhbGciOiJIUzI1NiJ9.payload",
+			wantErr:  jwt.ErrMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.Verify(t.Context(), tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if claims.String("sub") != "user" {
+				t.Fatalf("Verify() sub = %q, want %q", claims.String("sub"), "user")
+			}
+		})
+	}
+}
+
+func TestJWKSSharesConcurrentFetch(t *testing.T) {
+	keys := newTestKeys(t)
+
+	var hits atomic.Int32
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		hits.Add(1)
+		<-release
+		_, _ = w.Write(keys.jwks)
+	}))
+	defer server.Close()
+
+	jwks := jwt.NewJWKS(server.URL, time.Hour)
+
+	var wg sync.WaitGroup
+
+	errs := make(chan error, 10)
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := jwks.Key(t.Context(), "rsa")
+			errs <- err
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Key() error = %v", err)
+		}
+	}
+
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", got)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+
+	offCurve := ecJWK("bad", &keys.ec.PublicKey)
+	offCurve["y"] = b64(big.NewInt(1).FillBytes(make([]byte, 32)))
+
+	encryption := rsaJWK("enc", &keys.rsa.PublicKey)
+	encryption["use"] = "enc"
+
+	tests := []struct {
+		name     string
+		keys     []map[string]string
+		wantKids []string
+		wantErr  bool
+	}{
+		{
+			name: "rsa and ec",
+			keys: []map[string]string{
+				rsaJWK("rsa", &keys.rsa.PublicKey),
+				ecJWK("ec", &keys.ec.PublicKey),
+			},
+			wantKids: []string{"rsa", "ec"},
+		},
+		{
+			name:     "skips encryption keys",
+			keys:     []map[string]string{encryption, rsaJWK("rsa", &keys.rsa.PublicKey)},
+			wantKids: []string{"rsa"},
+		},
+		{
+			name:    "rejects points off the curve",
+			keys:    []map[string]string{offCurve},
+			wantErr: true,
+		},
+		{
+			name:    "no usable key",
+			keys:    []map[string]string{encryption},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jwt.ParseJWKS(mustJSON(t, map[string]any{"keys": tt.keys}))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParseJWKS() error = nil, want an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ParseJWKS() error = %v", err)
+			}
+
+			if len(got) != len(tt.wantKids) {
+				t.Fatalf("ParseJWKS() returned %d keys, want %d", len(got), len(tt.wantKids))
+			}
+
+			for _, kid := range tt.wantKids {
+				if _, ok := got[kid]; !ok {
+					t.Fatalf("ParseJWKS() missing key %q", kid)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Package lru provides a size bounded least recently used cache whose entries
+// expire after a fixed TTL.
+package lru
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type entry[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// Stats are the cumulative hit and miss counts of a cache
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+// Cache is safe for concurrent use, a nil *Cache never holds anything
+type Cache[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[K]*list.Element
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// New returns a cache holding at most size entries for at most ttl each, it
+// returns nil when size is not positive which disables caching
+func New[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	if size <= 0 {
+		return nil
+	}
+
+	return &Cache[K, V]{
+		size:    size,
+		ttl:     ttl,
+		ll:      list.New(),
+		entries: make(map[K]*list.Element, size),
+	}
+}
+
+// Get returns the cached value of key if it exists and has not expired
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	var zero V
+	if c == nil {
+		return zero, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return zero, false
+	}
+
+	e := valueOf[K, V](el)
+	if c.ttl > 0 && time.Now().After(e.expiresAt) {
+		c.removeElement(el)
+		c.misses.Add(1)
+
+		return zero, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.hits.Add(1)
+
+	return e.value, true
+}
+
+// Add inserts or replaces the value of key, evicting the least recently used
+// entry when the cache is full
+func (c *Cache[K, V]) Add(key K, value V) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+
+	if el, ok := c.entries[key]; ok {
+		e := valueOf[K, V](el)
+		e.value = value
+		e.expiresAt = expiresAt
+		c.ll.MoveToFront(el)
+
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, expiresAt: expiresAt})
+
+	if c.ll.Len() > c.size {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove deletes key from the cache
+func (c *Cache[K, V]) Remove(key K) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// Purge deletes every entry from the cache
+func (c *Cache[K, V]) Purge() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	clear(c.entries)
+}
+
+// Stats returns the cumulative hit and miss counts and the current size
+func (c *Cache[K, V]) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+
+	return Stats{
+		Hits:   c.hits.Load(),
+		Misses: c.misses.Load(),
+		Size:   size,
+	}
+}
+
+func (c *Cache[K, V]) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.entries, valueOf[K, V](el).key)
+}
+
+func valueOf[K comparable, V any](el *list.Element) *entry[K, V] {
+	e, ok := el.Value.(*entry[K, V])
+	if !ok {
+		panic(fmt.Sprintf("lru entry type error: %T, %v", el.Value, el.Value))
+	}
+
+	return e
+}
@@ -0,0 +1,135 @@
+package lru_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/lru"
+)
+
+type step struct {
+	op     string // add, get, remove, purge or wait
+	key    string
+	value  int
+	wait   time.Duration
+	want   int
+	wantOK bool
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		size      int
+		ttl       time.Duration
+		steps     []step
+		wantStats lru.Stats
+	}{
+		{
+			name: "evicts least recently used",
+			size: 2,
+			ttl:  time.Hour,
+			steps: []step{
+				{op: "add", key: "a", value: 1},
+				{op: "add", key: "b", value: 2},
+				// reading a makes b the least recently used entry
+				{op: "get", key: "a", want: 1, wantOK: true},
+				{op: "add", key: "c", value: 3},
+				{op: "get", key: "b"},
+				{op: "get", key: "a", want: 1, wantOK: true},
+				{op: "get", key: "c", want: 3, wantOK: true},
+			},
+			wantStats: lru.Stats{Hits: 3, Misses: 1, Size: 2},
+		},
+		{
+			name: "replacing a key refreshes it",
+			size: 2,
+			ttl:  time.Hour,
+			steps: []step{
+				{op: "add", key: "a", value: 1},
+				{op: "add", key: "b", value: 2},
+				{op: "add", key: "a", value: 10},
+				{op: "add", key: "c", value: 3},
+				{op: "get", key: "a", want: 10, wantOK: true},
+				{op: "get", key: "b"},
+			},
+			wantStats: lru.Stats{Hits: 1, Misses: 1, Size: 2},
+		},
+		{
+			name: "expires entries on get",
+			size: 2,
+			ttl:  20 * time.Millisecond,
+			steps: []step{
+				{op: "add", key: "a", value: 1},
+				{op: "get", key: "a", want: 1, wantOK: true},
+				{op: "wait", wait: 40 * time.Millisecond},
+				{op: "get", key: "a"},
+			},
+			wantStats: lru.Stats{Hits: 1, Misses: 1, Size: 0},
+		},
+		{
+			name: "remove and purge",
+			size: 3,
+			ttl:  time.Hour,
+			steps: []step{
+				{op: "add", key: "a", value: 1},
+				{op: "add", key: "b", value: 2},
+				{op: "remove", key: "a"},
+				{op: "get", key: "a"},
+				{op: "get", key: "b", want: 2, wantOK: true},
+				{op: "purge"},
+				{op: "get", key: "b"},
+			},
+			wantStats: lru.Stats{Hits: 1, Misses: 2, Size: 0},
+		},
+		{
+			name: "nil cache is a no-op",
+			size: 0,
+			ttl:  time.Hour,
+			steps: []step{
+				{op: "add", key: "a", value: 1},
+				{op: "get", key: "a"},
+				{op: "remove", key: "a"},
+				{op: "purge"},
+			},
+			wantStats: lru.Stats{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			c := lru.New[string, int](tt.size, tt.ttl)
+			if (c == nil) != (tt.size <= 0) {
+				t.Fatalf("New(%d) = %v", tt.size, c)
+			}
+
+			for i, s := range tt.steps {
+				switch s.op {
+				case "add":
+					c.Add(s.key, s.value)
+				case "get":
+					got, ok := c.Get(s.key)
+					if got != s.want || ok != s.wantOK {
+						t.Fatalf("step %d: Get(%q) = %d, %v, want %d, %v",
+							i, s.key, got, ok, s.want, s.wantOK)
+					}
+				case "remove":
+					c.Remove(s.key)
+				case "purge":
+					c.Purge()
+				case "wait":
+					time.Sleep(s.wait)
+				default:
+					t.Fatalf("step %d: unknown op %q", i, s.op)
+				}
+			}
+
+			if got := c.Stats(); got != tt.wantStats {
+				t.Fatalf("Stats() = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
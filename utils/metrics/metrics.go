@@ -0,0 +1,222 @@
+// Package metrics defines the Prometheus metrics of the proxy and serves them on
+// a separate port so that they are never exposed through the public listener.
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/lru"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "aiproxy"
+
+var (
+	// RequestsTotal counts the handled http requests
+	RequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, status code and model.",
+	}, []string{"route", "status", "model"})
+	// RequestDuration is the time spent handling http requests
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14),
+	}, []string{"route"})
+
+	// UpstreamDuration is the time from sending a request to the upstream until
+	// its response body was fully relayed
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Upstream request latency until the response is fully relayed.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	}, []string{"stream", "status"})
+	// UpstreamTTFB is the time from sending a streaming request to the upstream
+	// until the first event arrived
+	UpstreamTTFB = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_stream_ttfb_seconds",
+		Help:      "Time to the first byte of streaming upstream responses.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	})
+
+	// RateLimitRejections counts requests rejected by a limit
+	RateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by a limit, by limit.",
+	}, []string{"limit"})
+
+	// KeyValidations counts the calls to namespace resolvers
+	KeyValidations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "key_validations_total",
+		Help:      "Namespace resolver calls by resolver and result.",
+	}, []string{"resolver", "result"})
+	// KeyValidationDuration is the latency of namespace resolver calls
+	KeyValidationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "key_validation_duration_seconds",
+		Help:      "Namespace resolver latency by resolver.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"resolver"})
+
+	// DBQueryDuration is the latency of database queries observed by gorm callbacks
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation and result.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"operation", "result"})
+)
+
+const (
+	LimitIPBurst      = "ip_burst"
+	LimitIPDaily      = "ip_daily"
+	LimitNamespace    = "namespace"
+	LimitGlobalBudget = "global_budget"
+)
+
+func init() {
+	prometheus.MustRegister(
+		RequestsTotal,
+		RequestDuration,
+		UpstreamDuration,
+		UpstreamTTFB,
+		RateLimitRejections,
+		KeyValidations,
+		KeyValidationDuration,
+		DBQueryDuration,
+		caches,
+	)
+}
+
+// Since returns the seconds elapsed since start for observing histograms
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+func RunMetricsServer(port int) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	server := http.Server{
+		Addr:              net.JoinHostPort("", strconv.Itoa(port)),
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+
+	return server.ListenAndServe()
+}
+
+// maxModelLabels caps the distinct model label values, the model is taken from
+// the request body so it cannot be trusted to be bounded
+const maxModelLabels = 100
+
+const OtherModel = "other"
+
+var modelLabels = struct {
+	sync.RWMutex
+	seen map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+// ModelLabel returns the label value of a model. A model becomes a label value
+// only after the upstream accepted a request for it, until maxModelLabels are
+// known, every other model is reported as OtherModel.
+func ModelLabel(model string, accepted bool) string {
+	if model == "" {
+		return ""
+	}
+
+	modelLabels.RLock()
+	_, ok := modelLabels.seen[model]
+	modelLabels.RUnlock()
+
+	if ok {
+		return model
+	}
+
+	if !accepted {
+		return OtherModel
+	}
+
+	modelLabels.Lock()
+	defer modelLabels.Unlock()
+
+	if len(modelLabels.seen) >= maxModelLabels {
+		return OtherModel
+	}
+
+	modelLabels.seen[model] = struct{}{}
+
+	return model
+}
+
+// cacheCollector exposes the counters the lru caches already keep, so the
+// caches need no instrumentation of their own
+type cacheCollector struct {
+	mu     sync.Mutex
+	caches []namedCache
+}
+
+type namedCache struct {
+	name  string
+	stats func() lru.Stats
+}
+
+var (
+	cacheRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "requests_total"),
+		"Cache lookups by cache and result.",
+		[]string{"cache", "result"},
+		nil,
+	)
+	cacheEntriesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cache", "entries"),
+		"Entries currently held by the cache.",
+		[]string{"cache"},
+		nil,
+	)
+
+	caches = &cacheCollector{}
+)
+
+// RegisterCache exposes the hit, miss and size counts of a cache under name
+func RegisterCache(name string, stats func() lru.Stats) {
+	caches.mu.Lock()
+	defer caches.mu.Unlock()
+
+	caches.caches = append(caches.caches, namedCache{name: name, stats: stats})
+}
+
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+	ch <- cacheEntriesDesc
+}
+
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cache := range c.caches {
+		stats := cache.stats()
+
+		ch <- prometheus.MustNewConstMetric(
+			cacheRequestsDesc, prometheus.CounterValue, float64(stats.Hits), cache.name, "hit",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			cacheRequestsDesc, prometheus.CounterValue, float64(stats.Misses), cache.name, "miss",
+		)
+		ch <- prometheus.MustNewConstMetric(
+			cacheEntriesDesc, prometheus.GaugeValue, float64(stats.Size), cache.name,
+		)
+	}
+}
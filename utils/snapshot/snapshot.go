@@ -0,0 +1,89 @@
+// Package snapshot caches a value loaded from the database and reloads it once
+// it is older than a refresh interval, so changes made on other replicas apply.
+package snapshot
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Snapshot is safe for concurrent use. Concurrent reloads share one load that
+// runs without holding the lock, a failed load keeps the previous value until
+// the next refresh and Invalidate drops the value immediately
+type Snapshot[T any] struct {
+	load     func() (T, error)
+	interval func() time.Duration
+
+	mu       sync.Mutex
+	value    T
+	loaded   bool
+	loadedAt time.Time
+	// generation changes on every Invalidate so a load started before it
+	// neither replaces the value nor is joined afterwards
+	generation uint64
+	group      singleflight.Group
+}
+
+// New returns a snapshot reloaded by load once it is older than interval,
+// interval is read on every Get so it follows config reloads
+func New[T any](load func() (T, error), interval func() time.Duration) *Snapshot[T] {
+	return &Snapshot[T]{load: load, interval: interval}
+}
+
+// Get returns the current value, reloading it when it is stale. When the load
+// fails Get returns the previous value, or the zero value if none was loaded,
+// and the error is only reported to the caller that ran the load
+func (s *Snapshot[T]) Get() (T, error) {
+	s.mu.Lock()
+	value, loaded, loadedAt, generation := s.value, s.loaded, s.loadedAt, s.generation
+	s.mu.Unlock()
+
+	if loaded && time.Since(loadedAt) < s.interval() {
+		return value, nil
+	}
+
+	var loadErr error
+
+	v, _, _ := s.group.Do(strconv.FormatUint(generation, 10), func() (any, error) {
+		fresh, err := s.load()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if err != nil {
+			loadErr = err
+
+			// keep the previous value and retry after the interval instead of
+			// on every request while the database is failing
+			if s.generation == generation && s.loaded {
+				s.loadedAt = time.Now()
+			}
+
+			return s.value, nil
+		}
+
+		if s.generation == generation {
+			s.value, s.loaded, s.loadedAt = fresh, true, time.Now()
+		}
+
+		return fresh, nil
+	})
+
+	value, _ = v.(T)
+
+	return value, loadErr
+}
+
+// Invalidate drops the current value so the next Get reloads it
+func (s *Snapshot[T]) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var zero T
+
+	s.value, s.loaded = zero, false
+	s.generation++
+}
@@ -0,0 +1,151 @@
+package snapshot_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy-free/utils/snapshot"
+)
+
+var errLoad = errors.New("load failed")
+
+func TestSnapshotRefreshAndStale(t *testing.T) {
+	t.Parallel()
+
+	var (
+		calls atomic.Int64
+		fail  atomic.Bool
+	)
+
+	interval := time.Hour
+
+	s := snapshot.New(
+		func() (int64, error) {
+			n := calls.Add(1)
+			if fail.Load() {
+				return 0, errLoad
+			}
+
+			return n, nil
+		},
+		func() time.Duration { return interval },
+	)
+
+	if v, err := s.Get(); err != nil || v != 1 {
+		t.Fatalf("first Get = %d, %v, want 1, nil", v, err)
+	}
+
+	if v, _ := s.Get(); v != 1 || calls.Load() != 1 {
+		t.Fatalf("fresh Get = %d after %d loads, want 1 after 1", v, calls.Load())
+	}
+
+	// a failed refresh keeps the old value and waits an interval before retrying
+	interval = 0
+	fail.Store(true)
+
+	if v, err := s.Get(); !errors.Is(err, errLoad) || v != 1 {
+		t.Fatalf("failed Get = %d, %v, want 1, %v", v, err, errLoad)
+	}
+
+	interval = time.Hour
+
+	if v, err := s.Get(); err != nil || v != 1 || calls.Load() != 2 {
+		t.Fatalf("stale Get = %d, %v after %d loads, want 1, nil after 2", v, err, calls.Load())
+	}
+
+	// Invalidate drops the old value even while loads fail
+	s.Invalidate()
+
+	if v, err := s.Get(); !errors.Is(err, errLoad) || v != 0 {
+		t.Fatalf("Get after Invalidate = %d, %v, want 0, %v", v, err, errLoad)
+	}
+
+	fail.Store(false)
+
+	if v, err := s.Get(); err != nil || v != 4 {
+		t.Fatalf("recovered Get = %d, %v, want 4, nil", v, err)
+	}
+}
+
+func TestSnapshotSharesConcurrentLoad(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int64
+
+	release := make(chan struct{})
+
+	s := snapshot.New(
+		func() (int64, error) {
+			<-release
+			return calls.Add(1), nil
+		},
+		func() time.Duration { return time.Hour },
+	)
+
+	var wg sync.WaitGroup
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if v, err := s.Get(); err != nil || v != 1 {
+				t.Errorf("Get = %d, %v, want 1, nil", v, err)
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("load ran %d times, want 1", n)
+	}
+}
+
+func TestSnapshotInvalidateDiscardsInflightLoad(t *testing.T) {
+	t.Parallel()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var calls atomic.Int64
+
+	s := snapshot.New(
+		func() (int64, error) {
+			n := calls.Add(1)
+			if n == 1 {
+				close(started)
+				<-release
+			}
+
+			return n, nil
+		},
+		func() time.Duration { return time.Hour },
+	)
+
+	done := make(chan int64)
+
+	go func() {
+		v, _ := s.Get()
+		done <- v
+	}()
+
+	<-started
+	s.Invalidate()
+	close(release)
+
+	// a load started before Invalidate is returned to its caller but not cached
+	if v := <-done; v != 1 {
+		t.Fatalf("in-flight Get = %d, want 1", v)
+	}
+
+	if v, err := s.Get(); err != nil || v != 2 {
+		t.Fatalf("Get after Invalidate = %d, %v, want 2, nil", v, err)
+	}
+}